@@ -0,0 +1 @@
+ALTER TABLE cached_responses DROP COLUMN fetched_at;
@@ -0,0 +1 @@
+ALTER TABLE cached_responses ADD COLUMN fetched_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
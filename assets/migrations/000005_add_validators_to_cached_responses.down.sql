@@ -0,0 +1,2 @@
+ALTER TABLE cached_responses DROP COLUMN last_modified;
+ALTER TABLE cached_responses DROP COLUMN etag;
@@ -0,0 +1,2 @@
+ALTER TABLE cached_responses ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+ALTER TABLE cached_responses ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP INDEX cached_responses_url_idx;
@@ -0,0 +1,2 @@
+DELETE FROM cached_responses WHERE id NOT IN (SELECT MAX(id) FROM cached_responses GROUP BY url);
+CREATE UNIQUE INDEX cached_responses_url_idx ON cached_responses (url);
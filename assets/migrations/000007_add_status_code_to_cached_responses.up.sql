@@ -0,0 +1,2 @@
+ALTER TABLE cached_responses ADD COLUMN status_code INTEGER NOT NULL DEFAULT 200;
+UPDATE cached_responses SET status_code = 404, fetched_at = '1970-01-01 00:00:00' WHERE CAST(payload AS TEXT) = 'Not Found';
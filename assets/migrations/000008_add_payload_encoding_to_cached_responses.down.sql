@@ -0,0 +1,2 @@
+DELETE FROM cached_responses WHERE payload_encoding != 'identity';
+ALTER TABLE cached_responses DROP COLUMN payload_encoding;
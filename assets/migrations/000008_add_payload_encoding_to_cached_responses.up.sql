@@ -0,0 +1 @@
+ALTER TABLE cached_responses ADD COLUMN payload_encoding TEXT NOT NULL DEFAULT 'identity';
@@ -0,0 +1,9 @@
+DROP TABLE pokemon_moves;
+DROP TABLE moves;
+DROP TABLE pokemon_stats;
+DROP TABLE stats;
+DROP TABLE pokemon_abilities;
+DROP TABLE abilities;
+DROP TABLE pokemon_types;
+DROP TABLE types;
+DROP TABLE pokemon;
@@ -0,0 +1,67 @@
+CREATE TABLE pokemon (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    species TEXT NOT NULL,
+    height INTEGER NOT NULL,
+    weight INTEGER NOT NULL,
+    base_experience INTEGER NOT NULL,
+    is_default BOOLEAN NOT NULL,
+    sort_order INTEGER NOT NULL,
+    sprite_url TEXT NOT NULL,
+    synced_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE types (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE pokemon_types (
+    pokemon_id INTEGER NOT NULL REFERENCES pokemon (id) ON DELETE CASCADE,
+    type_id INTEGER NOT NULL REFERENCES types (id),
+    slot INTEGER NOT NULL,
+    PRIMARY KEY (pokemon_id, slot)
+);
+
+CREATE INDEX pokemon_types_type_id_idx ON pokemon_types (type_id);
+
+CREATE TABLE abilities (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE pokemon_abilities (
+    pokemon_id INTEGER NOT NULL REFERENCES pokemon (id) ON DELETE CASCADE,
+    ability_id INTEGER NOT NULL REFERENCES abilities (id),
+    slot INTEGER NOT NULL,
+    is_hidden BOOLEAN NOT NULL,
+    PRIMARY KEY (pokemon_id, slot)
+);
+
+CREATE INDEX pokemon_abilities_ability_id_idx ON pokemon_abilities (ability_id);
+
+CREATE TABLE stats (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE pokemon_stats (
+    pokemon_id INTEGER NOT NULL REFERENCES pokemon (id) ON DELETE CASCADE,
+    stat_id INTEGER NOT NULL REFERENCES stats (id),
+    base_stat INTEGER NOT NULL,
+    effort INTEGER NOT NULL,
+    PRIMARY KEY (pokemon_id, stat_id)
+);
+
+CREATE TABLE moves (
+    id INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE pokemon_moves (
+    pokemon_id INTEGER NOT NULL REFERENCES pokemon (id) ON DELETE CASCADE,
+    move_id INTEGER NOT NULL REFERENCES moves (id),
+    PRIMARY KEY (pokemon_id, move_id)
+);
+
+CREATE INDEX pokemon_moves_move_id_idx ON pokemon_moves (move_id);
@@ -0,0 +1,2 @@
+DROP INDEX pokemon_generation_idx;
+ALTER TABLE pokemon DROP COLUMN generation;
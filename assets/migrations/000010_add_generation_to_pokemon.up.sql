@@ -0,0 +1,17 @@
+ALTER TABLE pokemon ADD COLUMN generation INTEGER NOT NULL DEFAULT 0;
+
+-- Alternate forms (IDs above 10000) are filled in by the next catalog sync
+UPDATE pokemon SET generation = CASE
+    WHEN id <= 151 THEN 1
+    WHEN id <= 251 THEN 2
+    WHEN id <= 386 THEN 3
+    WHEN id <= 493 THEN 4
+    WHEN id <= 649 THEN 5
+    WHEN id <= 721 THEN 6
+    WHEN id <= 809 THEN 7
+    WHEN id <= 905 THEN 8
+    WHEN id <= 1025 THEN 9
+    ELSE 0
+END;
+
+CREATE INDEX pokemon_generation_idx ON pokemon (generation);
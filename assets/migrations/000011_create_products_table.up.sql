@@ -0,0 +1,17 @@
+CREATE TABLE products (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    sku TEXT NOT NULL UNIQUE,
+    pokemon_id INTEGER NOT NULL,
+    pokemon_name TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    active BOOLEAN NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE INDEX products_pokemon_id_idx ON products (pokemon_id);
@@ -0,0 +1,3 @@
+DROP TABLE inventory_adjustments;
+DROP TABLE inventory_reservations;
+DROP TABLE inventory;
@@ -0,0 +1,31 @@
+CREATE TABLE inventory (
+    product_id INTEGER NOT NULL PRIMARY KEY REFERENCES products (id),
+    on_hand INTEGER NOT NULL CHECK (on_hand >= 0),
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE TABLE inventory_reservations (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    reference TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL
+);
+
+CREATE INDEX inventory_reservations_product_id_idx ON inventory_reservations (product_id);
+CREATE INDEX inventory_reservations_reference_idx ON inventory_reservations (reference);
+CREATE INDEX inventory_reservations_expires_idx ON inventory_reservations (expires);
+
+CREATE TABLE inventory_adjustments (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    sku TEXT NOT NULL,
+    user_id INTEGER REFERENCES users (id),
+    delta INTEGER NOT NULL,
+    on_hand INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX inventory_adjustments_product_id_idx ON inventory_adjustments (product_id);
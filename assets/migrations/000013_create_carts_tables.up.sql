@@ -0,0 +1,14 @@
+CREATE TABLE carts (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER UNIQUE REFERENCES users (id),
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE TABLE cart_items (
+    cart_id INTEGER NOT NULL REFERENCES carts (id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    added TIMESTAMP NOT NULL,
+    PRIMARY KEY (cart_id, product_id)
+);
@@ -0,0 +1,42 @@
+CREATE TABLE orders (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    status TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    total INTEGER NOT NULL,
+    item_count INTEGER NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE INDEX orders_user_id_idx ON orders (user_id);
+CREATE INDEX orders_status_idx ON orders (status);
+
+CREATE TABLE order_items (
+    order_id INTEGER NOT NULL REFERENCES orders (id),
+    product_id INTEGER NOT NULL,
+    sku TEXT NOT NULL,
+    name TEXT NOT NULL,
+    pokemon_id INTEGER NOT NULL,
+    pokemon_name TEXT NOT NULL,
+    variant TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    unit_price INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    subtotal INTEGER NOT NULL,
+    PRIMARY KEY (order_id, product_id)
+);
+
+CREATE INDEX order_items_sku_idx ON order_items (sku);
+
+CREATE TABLE order_history (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL REFERENCES orders (id),
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    user_id INTEGER REFERENCES users (id),
+    note TEXT NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX order_history_order_id_idx ON order_history (order_id);
@@ -0,0 +1,23 @@
+CREATE TABLE payments (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL REFERENCES orders (id),
+    provider TEXT NOT NULL,
+    intent_id TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL,
+    UNIQUE (provider, intent_id)
+);
+
+CREATE INDEX payments_order_id_idx ON payments (order_id);
+
+CREATE TABLE payment_events (
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    intent_id TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, event_id)
+);
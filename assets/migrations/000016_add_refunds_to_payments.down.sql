@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN refund_error;
+ALTER TABLE payments DROP COLUMN refund_due;
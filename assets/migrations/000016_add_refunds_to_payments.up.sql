@@ -0,0 +1,2 @@
+ALTER TABLE payments ADD COLUMN refund_due BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE payments ADD COLUMN refund_error TEXT NOT NULL DEFAULT '';
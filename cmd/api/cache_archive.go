@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+)
+
+// Cache archives are NDJSON files, gzipped when the file name ends in .gz.
+// The first line is a cacheArchiveHeader and every following line is a
+// cacheArchiveRecord.
+const cacheArchiveFormat = "pokemon-store-cache"
+
+// Version 1 archives embedded JSON payloads, which could not be imported
+// byte for byte, and are no longer read.
+const cacheArchiveVersion = 2
+
+type cacheArchiveHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	BaseURL    string    `json:"base_url"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+type cacheArchiveRecord struct {
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	FetchedAt  time.Time         `json:"fetched_at"`
+
+	// Payloads are base64 encoded so that they are imported exactly as they
+	// were cached, empty ones included.
+	Payload []byte `json:"payload"`
+}
+
+// exportCache writes every cached response to an archive that importCache can
+// load into another database.
+func (app *application) exportCache(args []string) error {
+	fs := flag.NewFlagSet("cache-export", flag.ContinueOnError)
+	dsn := fs.String("dsn", app.config.db.dsn, "database to export from")
+	output := fs.String("o", "-", "archive file to write, - for stdout")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	db, err := app.openDatabase(*dsn)
+	if err != nil {
+		return err
+	}
+	if db != app.db {
+		defer db.Close()
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	w = buffered
+
+	var zw *gzip.Writer
+	if strings.HasSuffix(*output, ".gz") {
+		zw = gzip.NewWriter(buffered)
+		w = zw
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	err = enc.Encode(cacheArchiveHeader{
+		Format:     cacheArchiveFormat,
+		Version:    cacheArchiveVersion,
+		BaseURL:    app.upstream.BaseURL(),
+		ExportedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	exported := 0
+
+	for afterID := 0; ; {
+		cachedResponses, err := db.ListCachedResponsesAfter(afterID, 100)
+		if err != nil {
+			return err
+		}
+
+		if len(cachedResponses) == 0 {
+			break
+		}
+
+		for _, cachedResponse := range cachedResponses {
+			afterID = cachedResponse.ID
+
+			record := cacheArchiveRecord{
+				URL:        cachedResponse.URL,
+				StatusCode: cachedResponse.StatusCode,
+				Headers:    map[string]string{},
+				FetchedAt:  cachedResponse.FetchedAt.UTC(),
+				Payload:    cachedResponse.Payload,
+			}
+
+			if cachedResponse.ETag != "" {
+				record.Headers["ETag"] = cachedResponse.ETag
+			}
+			if cachedResponse.LastModified != "" {
+				record.Headers["Last-Modified"] = cachedResponse.LastModified
+			}
+
+			err = enc.Encode(record)
+			if err != nil {
+				return err
+			}
+
+			exported++
+		}
+	}
+
+	if zw != nil {
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = buffered.Flush()
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("cache export complete", "entries", exported, "output", *output)
+	return nil
+}
+
+// importCache merges an archive written by exportCache into a database.
+// Existing entries are only replaced by older archived ones when
+// -overwrite-newer is given.
+func (app *application) importCache(args []string) error {
+	fs := flag.NewFlagSet("cache-import", flag.ContinueOnError)
+	dsn := fs.String("dsn", app.config.db.dsn, "database to import into, created and migrated if needed")
+	overwriteNewer := fs.Bool("overwrite-newer", false, "replace entries even when the existing copy was fetched more recently")
+	rebase := fs.Bool("rebase", false, "rewrite the archive's upstream base URL to POKEAPI_BASE_URL in URLs and payloads")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: cache-import [flags] <archive>, use - for stdin")
+	}
+
+	db, err := app.openDatabase(*dsn)
+	if err != nil {
+		return err
+	}
+	if db != app.db {
+		defer db.Close()
+	}
+
+	var r io.Reader = os.Stdin
+
+	if name := fs.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		r = file
+
+		if strings.HasSuffix(name, ".gz") {
+			zr, err := gzip.NewReader(file)
+			if err != nil {
+				return err
+			}
+			defer zr.Close()
+
+			r = zr
+		}
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var header cacheArchiveHeader
+
+	err = dec.Decode(&header)
+	if err != nil {
+		return fmt.Errorf("reading archive header: %w", err)
+	}
+
+	if header.Format != cacheArchiveFormat || header.Version != cacheArchiveVersion {
+		return fmt.Errorf("unsupported archive format %q version %d", header.Format, header.Version)
+	}
+
+	rewrite := func(s string) string { return s }
+	if *rebase && header.BaseURL != app.upstream.BaseURL() {
+		replacer := strings.NewReplacer(header.BaseURL, app.upstream.BaseURL())
+		rewrite = replacer.Replace
+	}
+
+	var imported, skipped int
+
+	for line := 2; ; line++ {
+		var record cacheArchiveRecord
+
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive record %d: %w", line, err)
+		}
+
+		written, err := db.ImportCachedResponse(&database.CachedResponse{
+			URL:          rewrite(record.URL),
+			StatusCode:   record.StatusCode,
+			Payload:      []byte(rewrite(string(record.Payload))),
+			FetchedAt:    record.FetchedAt,
+			ETag:         record.Headers["ETag"],
+			LastModified: record.Headers["Last-Modified"],
+		}, *overwriteNewer)
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", record.URL, err)
+		}
+
+		if written {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+
+	app.logger.Info("cache import complete", "imported", imported, "skipped", skipped, "exportedAt", header.ExportedAt)
+	return nil
+}
+
+// openDatabase returns the application's database for its own DSN, or opens
+// and migrates a separate one that the caller must close.
+func (app *application) openDatabase(dsn string) (*database.DB, error) {
+	if dsn == app.config.db.dsn {
+		return app.db, nil
+	}
+
+	return database.New(dsn, true)
+}
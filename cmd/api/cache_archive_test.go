@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/upstream"
+)
+
+func TestCacheArchiveRoundTrip(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.upstream = upstream.New(upstream.Options{BaseURL: "https://pokeapi.co/api/v2"})
+
+	payloads := map[string][]byte{
+		"https://pokeapi.co/api/v2/pokemon/pikachu": []byte("{\n  \"name\": \"pikachu\",\n  \"id\": 25\n}\n"),
+		"https://pokeapi.co/api/v2/pokemon/empty":   {},
+		"https://pokeapi.co/api/v2/sprite/25":       {0x89, 'P', 'N', 'G', 0x00, 0xff},
+	}
+
+	for url, payload := range payloads {
+		err := app.db.UpsertCachedResponse(url, 200, payload, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "cache.ndjson.gz")
+
+	err := app.exportCache([]string{"-o", archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsn := filepath.Join(t.TempDir(), "imported.sqlite")
+
+	err = app.importCache([]string{"-dsn", dsn, archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := database.New(dsn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+
+	for url, payload := range payloads {
+		cachedResponse, err := imported.GetCachedResponse(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cachedResponse == nil {
+			t.Errorf("%s was not imported", url)
+			continue
+		}
+
+		if cachedResponse.Payload == nil || !bytes.Equal(cachedResponse.Payload, payload) {
+			t.Errorf("%s was imported as %q; want %q", url, cachedResponse.Payload, payload)
+		}
+	}
+}
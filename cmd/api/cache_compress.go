@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// compressCache is a one-off tool that compresses cached responses stored
+// before payload compression was introduced. New and refreshed entries are
+// compressed as they are written, so it only needs to be run once after
+// upgrading, but is safe to run again.
+func (app *application) compressCache(args []string) error {
+	fs := flag.NewFlagSet("cache-compress", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 100, "number of rows compressed per query")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *batchSize < 1 {
+		return errors.New("batch-size must be positive")
+	}
+
+	var rows, compressed int
+	var bytesBefore, bytesAfter int64
+
+	for afterID := 0; ; {
+		lastID, recompression, err := app.db.RecompressCachedResponses(afterID, *batchSize)
+		if err != nil {
+			return err
+		}
+
+		if lastID == 0 {
+			break
+		}
+
+		afterID = lastID
+		rows += recompression.Rows
+		compressed += recompression.Compressed
+		bytesBefore += recompression.BytesBefore
+		bytesAfter += recompression.BytesAfter
+	}
+
+	saved := bytesBefore - bytesAfter
+
+	var percent float64
+	if bytesBefore > 0 {
+		percent = float64(saved) / float64(bytesBefore) * 100
+	}
+
+	app.logger.Info("cache compression complete",
+		"rows", rows,
+		"compressed", compressed,
+		"bytesBefore", bytesBefore,
+		"bytesAfter", bytesAfter,
+		"bytesSaved", saved,
+		"percentSaved", fmt.Sprintf("%.1f%%", percent),
+	)
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// warmCache walks every page of the Pokémon list and then fetches each
+// Pokémon so that a fresh deploy starts with a populated cache. Entries that
+// are already fresh are skipped without contacting upstream, which makes an
+// interrupted run resumable by simply running it again.
+func (app *application) warmCache(args []string) error {
+	fs := flag.NewFlagSet("cache-warm", flag.ContinueOnError)
+	concurrency := fs.Int("concurrency", 4, "number of Pokémon fetched in parallel")
+	rate := fs.Float64("rate", 5, "maximum upstream requests per second")
+	pageSize := fs.Int("page-size", 20, "list page size to walk, match the storefront's limit so its pages are warmed too")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *concurrency < 1 || *rate <= 0 || *pageSize < 1 {
+		return errors.New("concurrency, rate and page-size must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+	defer limiter.Stop()
+
+	// waitForUpstream blocks until the rate limit allows another request to a
+	// URL that is not already fresh in the cache.
+	waitForUpstream := func(url string) (bool, error) {
+		fresh, err := app.cache.Fresh(url)
+		if err != nil || fresh {
+			return fresh, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-limiter.C:
+			return false, nil
+		}
+	}
+
+	var found, warmed, skipped, failed atomic.Int64
+
+	progress := func(msg string) {
+		app.logger.Info(msg, slog.Group("pokemon",
+			"found", found.Load(),
+			"warmed", warmed.Load(),
+			"skipped", skipped.Load(),
+			"failed", failed.Load(),
+		))
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range jobs {
+				fresh, err := waitForUpstream(app.pokemon.SinglePokemonURL(id))
+				switch {
+				case errors.Is(err, context.Canceled):
+					return
+				case err != nil:
+					failed.Add(1)
+					app.logger.Warn(err.Error(), "pokemon", id)
+					continue
+				case fresh:
+					skipped.Add(1)
+					continue
+				}
+
+				_, cacheInfo, err := app.pokemon.GetSinglePokemon(id)
+				if err == nil && cacheInfo.Revalidate != nil {
+					err = cacheInfo.Revalidate()
+				}
+
+				if err != nil {
+					failed.Add(1)
+					app.logger.Warn(err.Error(), "pokemon", id)
+					continue
+				}
+
+				warmed.Add(1)
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				progress("cache warm-up progress")
+			}
+		}
+	}()
+
+	app.logger.Info("starting cache warm-up", "concurrency", *concurrency, "rate", *rate, "pageSize", *pageSize)
+
+	err = func() error {
+		defer close(jobs)
+
+		for offset := 0; ; offset += *pageSize {
+			_, err := waitForUpstream(app.pokemon.PokemonsURL(offset, *pageSize))
+			if err != nil {
+				return err
+			}
+
+			page, cacheInfo, err := app.pokemon.GetPokemons(offset, *pageSize)
+			if err == nil && cacheInfo.Revalidate != nil {
+				err = cacheInfo.Revalidate()
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, result := range page.Results {
+				// Warm the ID based URLs that the list hands out to clients
+				id := path.Base(strings.TrimSuffix(result.URL, "/"))
+				found.Add(1)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case jobs <- id:
+				}
+			}
+
+			if page.Next == nil {
+				return nil
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if errors.Is(err, context.Canceled) {
+		progress("cache warm-up interrupted, run it again to resume")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	progress("cache warm-up complete")
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+)
+
+// syncCatalogPokemon copies a Pokémon read through the response cache into
+// the normalized catalog tables.
+func (app *application) syncCatalogPokemon(p pokemon.SinglePokemon) error {
+	catalogPokemon, err := newCatalogPokemon(p)
+	if err != nil {
+		return err
+	}
+
+	return app.db.UpsertCatalogPokemon(catalogPokemon)
+}
+
+func newCatalogPokemon(p pokemon.SinglePokemon) (*database.CatalogPokemon, error) {
+	catalogPokemon := &database.CatalogPokemon{
+		ID:             p.ID,
+		Name:           p.Name,
+		Species:        p.Species.Name,
+		Height:         p.Height,
+		Weight:         p.Weight,
+		BaseExperience: p.BaseExperience,
+		IsDefault:      p.IsDefault,
+		Order:          p.Order,
+		SpriteURL:      p.Sprites.Other.OfficialArtwork.FrontDefault,
+	}
+
+	species, err := newCatalogResource(p.Species.Name, p.Species.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogPokemon.Generation = pokemon.Generation(species.ID)
+
+	if catalogPokemon.SpriteURL == "" {
+		catalogPokemon.SpriteURL = p.Sprites.FrontDefault
+	}
+
+	for _, t := range p.Types {
+		resource, err := newCatalogResource(t.Type.Name, t.Type.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		catalogPokemon.Types = append(catalogPokemon.Types, database.CatalogPokemonType{Slot: t.Slot, Type: resource})
+	}
+
+	for _, a := range p.Abilities {
+		resource, err := newCatalogResource(a.Ability.Name, a.Ability.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		catalogPokemon.Abilities = append(catalogPokemon.Abilities, database.CatalogPokemonAbility{
+			Slot:     a.Slot,
+			IsHidden: a.IsHidden,
+			Ability:  resource,
+		})
+	}
+
+	for _, s := range p.Stats {
+		resource, err := newCatalogResource(s.Stat.Name, s.Stat.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		catalogPokemon.Stats = append(catalogPokemon.Stats, database.CatalogPokemonStat{
+			Stat:     resource,
+			BaseStat: s.BaseStat,
+			Effort:   s.Effort,
+		})
+	}
+
+	for _, m := range p.Moves {
+		resource, err := newCatalogResource(m.Move.Name, m.Move.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		catalogPokemon.Moves = append(catalogPokemon.Moves, resource)
+	}
+
+	return catalogPokemon, nil
+}
+
+// newCatalogResource takes the ID of a named PokeAPI resource from the end of
+// its URL, e.g. https://pokeapi.co/api/v2/type/10/.
+func newCatalogResource(name, url string) (database.CatalogResource, error) {
+	id, err := strconv.Atoi(path.Base(strings.TrimSuffix(url, "/")))
+	if err != nil {
+		return database.CatalogResource{}, fmt.Errorf("no resource ID in %q: %w", url, err)
+	}
+
+	return database.CatalogResource{ID: id, Name: name}, nil
+}
+
+// syncCatalog walks every Pokémon through the response cache and writes it to
+// the catalog. Pokémon that are not cached yet are fetched from upstream, so
+// run cache-warm first to rate limit those requests.
+func (app *application) syncCatalog(args []string) error {
+	fs := flag.NewFlagSet("catalog-sync", flag.ContinueOnError)
+	pageSize := fs.Int("page-size", 100, "list page size to walk")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *pageSize < 1 {
+		return errors.New("page-size must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var synced, failed int
+
+	for offset := 0; ; offset += *pageSize {
+		page, _, err := app.pokemon.GetPokemons(offset, *pageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range page.Results {
+			if ctx.Err() != nil {
+				app.logger.Info("catalog sync interrupted", "synced", synced, "failed", failed)
+				return nil
+			}
+
+			id := path.Base(strings.TrimSuffix(result.URL, "/"))
+
+			p, _, err := app.pokemon.GetSinglePokemon(id)
+			if err == nil {
+				err = app.syncCatalogPokemon(p)
+			}
+
+			if err != nil {
+				failed++
+				app.logger.Warn(err.Error(), "pokemon", id)
+				continue
+			}
+
+			synced++
+		}
+
+		if page.Next == nil {
+			break
+		}
+	}
+
+	app.logger.Info("catalog sync complete", "synced", synced, "failed", failed)
+	return nil
+}
+
+func (app *application) getCatalogStats(w http.ResponseWriter, r *http.Request) {
+	totals, err := app.db.GetCatalogTotals()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, totals)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strings"
 
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
 	"github.com/amirulabu/pokemon-store-backend/internal/response"
 	"github.com/amirulabu/pokemon-store-backend/internal/validator"
 
@@ -60,6 +62,27 @@ func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
 	app.errorMessage(w, r, http.StatusNotFound, message, nil)
 }
 
+func (app *application) badGateway(w http.ResponseWriter, r *http.Request, err error) {
+	requestAttrs := slog.Group("request", "method", r.Method, "url", r.URL.String())
+	app.logger.Warn(err.Error(), requestAttrs)
+
+	message := "The upstream server could not fulfil your request"
+	app.errorMessage(w, r, http.StatusBadGateway, message, nil)
+}
+
+func (app *application) upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var upstreamErr *cached_http.UpstreamError
+
+	switch {
+	case errors.Is(err, cached_http.ErrNotFound):
+		app.notFound(w, r)
+	case errors.As(err, &upstreamErr):
+		app.badGateway(w, r, err)
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
 func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("The %s method is not supported for this resource", r.Method)
 	app.errorMessage(w, r, http.StatusMethodNotAllowed, message, nil)
@@ -69,6 +92,11 @@ func (app *application) badRequest(w http.ResponseWriter, r *http.Request, err e
 	app.errorMessage(w, r, http.StatusBadRequest, err.Error(), nil)
 }
 
+func (app *application) editConflict(w http.ResponseWriter, r *http.Request) {
+	message := "Unable to update the record due to an edit conflict, please try again"
+	app.errorMessage(w, r, http.StatusConflict, message, nil)
+}
+
 func (app *application) failedValidation(w http.ResponseWriter, r *http.Request, v validator.Validator) {
 	err := response.JSON(w, http.StatusUnprocessableEntity, v)
 	if err != nil {
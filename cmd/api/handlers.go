@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
 	"github.com/amirulabu/pokemon-store-backend/internal/password"
 	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
 	"github.com/amirulabu/pokemon-store-backend/internal/request"
@@ -27,6 +31,21 @@ func (app *application) status(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getURLQueryParamList splits a comma separated query parameter, ignoring
+// empty items.
+func getURLQueryParamList(r *http.Request, key string) []string {
+	var values []string
+
+	for _, value := range strings.Split(r.URL.Query().Get(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
 func getURLQueryParamInt(r *http.Request, key string, defaultValue int) int {
 	value := r.URL.Query().Get(key)
 	if value == "" {
@@ -37,15 +56,25 @@ func getURLQueryParamInt(r *http.Request, key string, defaultValue int) int {
 }
 
 func (app *application) getPokemons(w http.ResponseWriter, r *http.Request) {
+	if hasCatalogFilters(r.URL.Query()) {
+		app.getCatalogPokemons(w, r)
+		return
+	}
+
 	limit := getURLQueryParamInt(r, "limit", 20)
 	offset := getURLQueryParamInt(r, "offset", 0)
 
-	data, err := pokemon.GetPokemons(offset, limit, app.config.baseURL, app.db)
+	data, cacheInfo, err := app.pokemon.GetPokemons(offset, limit)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.upstreamError(w, r, err)
+		return
 	}
 
-	resErr := response.JSON(w, http.StatusOK, data)
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	resErr := response.JSONWithHeaders(w, http.StatusOK, data, cacheHeaders(cacheInfo.Status))
 	if resErr != nil {
 		app.serverError(w, r, resErr)
 	}
@@ -54,15 +83,123 @@ func (app *application) getPokemons(w http.ResponseWriter, r *http.Request) {
 func (app *application) getPokemonByNameOrId(w http.ResponseWriter, r *http.Request) {
 	name := flow.Param(r.Context(), "nameOrId")
 
-	data, err := pokemon.GetSinglePokemon(name, app.db)
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		view = pokemon.ViewV1
+	}
+
+	fields := getURLQueryParamList(r, "fields")
+	includes := getURLQueryParamList(r, "include")
+
+	var v validator.Validator
+
+	v.CheckField(validator.In(view, pokemon.ViewV1, pokemon.ViewRaw), "view", "Must be v1 or raw")
+	v.CheckField(view == pokemon.ViewV1 || (len(fields) == 0 && len(includes) == 0), "view", "Must be v1 when fields or include are given")
+
+	var unknownFields []string
+	for _, field := range fields {
+		if _, ok := pokemon.PokemonV1Fields[field]; !ok {
+			unknownFields = append(unknownFields, field)
+		}
+	}
+
+	v.CheckField(len(unknownFields) == 0, "fields", fmt.Sprintf("Unknown fields %s, must be any of %s", strings.Join(unknownFields, ", "), strings.Join(pokemonV1FieldNames(), ", ")))
+	v.CheckField(validator.NoDuplicates(fields), "fields", "Must not contain duplicates")
+	v.CheckField(validator.AllIn(includes, pokemonIncludes...), "include", "Must be any of "+strings.Join(pokemonIncludes, ", "))
+	v.CheckField(validator.NoDuplicates(includes), "include", "Must not contain duplicates")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	data, cacheInfo, err := app.pokemon.GetSinglePokemon(name)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	// Freshly fetched Pokémon are added to the catalog as they are seen
+	if cacheInfo.Status == cached_http.StatusMiss {
+		app.backgroundTask(r, func() error { return app.syncCatalogPokemon(data) })
+	}
+
+	headers := cacheHeaders(cacheInfo.Status)
+	headers.Set("X-Pokemon-View", view)
+
+	if view == pokemon.ViewRaw {
+		err = response.JSONWithHeaders(w, http.StatusOK, data, headers)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if len(fields) == 0 && len(includes) == 0 {
+		err = response.JSONWithHeaders(w, http.StatusOK, pokemon.NewPokemonV1(data), headers)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if len(fields) == 0 {
+		fields = pokemonV1FieldNames()
+	}
+
+	body := pokemon.NewPokemonV1(data).Select(fields)
+
+	if len(includes) > 0 {
+		species, speciesInfo, err := app.getSpeciesOf(r, data)
+		if err != nil {
+			app.upstreamError(w, r, err)
+			return
+		}
+
+		infos := []cached_http.Info{cacheInfo, speciesInfo}
+
+		if validator.In("species", includes...) {
+			body["Species"] = app.pokemon.NewSpeciesV1(species)
+		}
+
+		if validator.In("evolution_chain", includes...) {
+			chain, chainInfo, err := app.getEvolutionChainOf(r, species)
+			if err != nil {
+				app.upstreamError(w, r, err)
+				return
+			}
+
+			body["EvolutionChain"] = app.pokemon.NewEvolutionsV1(chain)
+			infos = append(infos, chainInfo)
+		}
+
+		// Report the stalest of the resources the response was built from
+		headers = cacheHeaders(cached_http.MergeInfo(infos...).Status)
+		headers.Set("X-Pokemon-View", view)
+	}
+
+	err = response.JSONWithHeaders(w, http.StatusOK, body, headers)
 	if err != nil {
 		app.serverError(w, r, err)
 	}
+}
 
-	resErr := response.JSON(w, http.StatusOK, data)
-	if resErr != nil {
-		app.serverError(w, r, resErr)
+// pokemonIncludes are the related resources that can be embedded in a single
+// Pokémon with ?include=.
+var pokemonIncludes = []string{"species", "evolution_chain"}
+
+func pokemonV1FieldNames() []string {
+	names := make([]string, 0, len(pokemon.PokemonV1Fields))
+	for name := range pokemon.PokemonV1Fields {
+		names = append(names, name)
 	}
+
+	sort.Strings(names)
+	return names
 }
 
 func (app *application) createUser(w http.ResponseWriter, r *http.Request) {
@@ -151,6 +288,12 @@ func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http
 		return
 	}
 
+	err = app.mergeAnonymousCart(w, r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	var claims jwt.Claims
 	claims.Subject = strconv.Itoa(user.ID)
 
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+func (app *application) listCachedResponses(w http.ResponseWriter, r *http.Request) {
+	offset := getURLQueryParamInt(r, "offset", 0)
+	limit := getURLQueryParamInt(r, "limit", 20)
+
+	var v validator.Validator
+
+	v.CheckField(offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	totals, err := app.db.GetCachedResponseTotals()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	summaries, err := app.db.ListCachedResponses(offset, limit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	type result struct {
+		*database.CachedResponseSummary
+		Age string
+	}
+
+	results := make([]result, len(summaries))
+	for i, summary := range summaries {
+		results[i] = result{
+			CachedResponseSummary: summary,
+			Age:                   time.Since(summary.FetchedAt).Round(time.Second).String(),
+		}
+	}
+
+	data := map[string]any{
+		"Count":   totals.Count,
+		"Offset":  offset,
+		"Limit":   limit,
+		"Results": results,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getCachedResponsePayload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(flow.Param(r.Context(), "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	cachedResponse, err := app.db.GetCachedResponseByID(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if cachedResponse == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if json.Valid(cachedResponse.Payload) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	w.Header().Set("X-Cache-URL", cachedResponse.URL)
+	w.Header().Set("X-Cache-Fetched-At", cachedResponse.FetchedAt.Format(time.RFC3339))
+	w.Header().Set("X-Upstream-Status", strconv.Itoa(cachedResponse.StatusCode))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(cachedResponse.Payload)
+}
+
+func (app *application) purgeCachedResponses(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	prefix := r.URL.Query().Get("prefix")
+
+	var v validator.Validator
+
+	v.Check(url != "" || prefix != "", "Either url or prefix is required")
+	v.Check(url == "" || prefix == "", "Only one of url or prefix may be given")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	var deleted int
+	var err error
+
+	if url != "" {
+		deleted, err = app.cache.Invalidate(url)
+	} else {
+		deleted, err = app.cache.InvalidatePrefix(prefix)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]int{"Deleted": deleted})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) purgeAllCachedResponses(w http.ResponseWriter, r *http.Request) {
+	deleted, err := app.cache.InvalidateAll()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]int{"Deleted": deleted})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	totals, err := app.db.GetCachedResponseTotals()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Count":  totals.Count,
+		"Bytes":  totals.Bytes,
+		"Memory": app.cache.MemoryStats(),
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getCacheMemoryStats(w http.ResponseWriter, r *http.Request) {
+	err := response.JSON(w, http.StatusOK, app.cache.MemoryStats())
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getUpstreamStatus(w http.ResponseWriter, r *http.Request) {
+	data := map[string]any{
+		"BaseURL": app.upstream.BaseURL(),
+		"Breaker": app.upstream.BreakerStatus(),
+	}
+
+	err := response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,615 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/cookies"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/request"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+// Anonymous clients find their cart again through the encrypted cart cookie,
+// which holds its ID.
+const (
+	cartCookieName   = "cart"
+	cartCookieMaxAge = 30 * 24 * time.Hour
+)
+
+type cartItemResponse struct {
+	Product   productResponse
+	Quantity  int
+	Available int
+	Subtotal  int64
+}
+
+// cartResponse totals the items that can be bought in the cart's currency,
+// leaving out products that were deactivated after they were added.
+type cartResponse struct {
+	Items         []cartItemResponse
+	ItemCount     int
+	Currency      string
+	Total         int64
+	ReservedUntil *time.Time
+}
+
+// findCart returns the cart of the authenticated user or, for an anonymous
+// client, the one in its cart cookie. It returns nil if there is none.
+func (app *application) findCart(r *http.Request) (*database.Cart, error) {
+	user := contextGetAuthenticatedUser(r)
+	if user != nil {
+		return app.db.GetCartByUserID(user.ID)
+	}
+
+	return app.findAnonymousCart(r)
+}
+
+func (app *application) findAnonymousCart(r *http.Request) (*database.Cart, error) {
+	value, err := cookies.ReadEncrypted(r, cartCookieName, app.config.cookie.secretKey)
+	switch {
+	case errors.Is(err, http.ErrNoCookie), errors.Is(err, cookies.ErrInvalidValue):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, nil
+	}
+
+	return app.db.GetAnonymousCart(id)
+}
+
+// findOrCreateCart is findCart, creating a cart if there is none and writing
+// the cart cookie for new anonymous carts.
+func (app *application) findOrCreateCart(w http.ResponseWriter, r *http.Request) (*database.Cart, error) {
+	cart, err := app.findCart(r)
+	if err != nil || cart != nil {
+		return cart, err
+	}
+
+	user := contextGetAuthenticatedUser(r)
+	if user != nil {
+		return app.db.InsertCart(&user.ID)
+	}
+
+	cart, err = app.db.InsertCart(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	cookie := http.Cookie{
+		Name:     cartCookieName,
+		Value:    strconv.Itoa(cart.ID),
+		Path:     "/",
+		MaxAge:   int(cartCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	err = cookies.WriteEncrypted(w, cookie, app.config.cookie.secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// mergeAnonymousCart moves the items in the client's anonymous cart, if it
+// has one, into the user's cart and removes the cart cookie.
+func (app *application) mergeAnonymousCart(w http.ResponseWriter, r *http.Request, user *database.User) error {
+	anonymousCart, err := app.findAnonymousCart(r)
+	if err != nil || anonymousCart == nil {
+		return err
+	}
+
+	cart, err := app.db.GetCartByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if cart == nil {
+		cart, err = app.db.InsertCart(&user.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.db.MergeCarts(anonymousCart.ID, cart.ID)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cartCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// cartContents is a cart's items together with their products and stock.
+// Items whose product has been deleted are left out.
+type cartContents struct {
+	items    []*database.CartItem
+	products map[int]*database.Product
+	levels   map[int]*database.InventoryLevel
+}
+
+func (app *application) getCartContents(cart *database.Cart) (*cartContents, error) {
+	contents := &cartContents{
+		products: map[int]*database.Product{},
+		levels:   map[int]*database.InventoryLevel{},
+	}
+
+	if cart == nil {
+		return contents, nil
+	}
+
+	items, err := app.db.GetCartItems(cart.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		product, err := app.db.GetProduct(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		if product == nil {
+			continue
+		}
+
+		level, err := app.db.GetInventoryLevel(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		contents.items = append(contents.items, item)
+		contents.products[item.ProductID] = product
+		contents.levels[item.ProductID] = level
+	}
+
+	return contents, nil
+}
+
+// currency is the currency of the first item in the cart, which every other
+// item is expected to share.
+func (contents *cartContents) currency() string {
+	if len(contents.items) == 0 {
+		return ""
+	}
+
+	return contents.products[contents.items[0].ProductID].Currency
+}
+
+func (contents *cartContents) quantity(productID int) int {
+	for _, item := range contents.items {
+		if item.ProductID == productID {
+			return item.Quantity
+		}
+	}
+
+	return 0
+}
+
+func (app *application) newCartResponse(cart *database.Cart, contents *cartContents) (cartResponse, error) {
+	data := cartResponse{
+		Items:    make([]cartItemResponse, 0, len(contents.items)),
+		Currency: contents.currency(),
+	}
+
+	if data.Currency == "" {
+		data.Currency = app.config.store.currency
+	}
+
+	for _, item := range contents.items {
+		product := contents.products[item.ProductID]
+
+		itemData := cartItemResponse{
+			Product:   app.newProductResponse(product),
+			Quantity:  item.Quantity,
+			Available: contents.levels[item.ProductID].Available,
+			Subtotal:  product.Price * int64(item.Quantity),
+		}
+
+		if product.Active && product.Currency == data.Currency {
+			data.ItemCount += item.Quantity
+			data.Total += itemData.Subtotal
+		}
+
+		data.Items = append(data.Items, itemData)
+	}
+
+	if cart != nil {
+		reservedUntil, err := app.db.GetReservationExpiry(database.CartReservation(cart.ID))
+		if err != nil {
+			return cartResponse{}, err
+		}
+
+		data.ReservedUntil = reservedUntil
+	}
+
+	return data, nil
+}
+
+// writeCart responds with the current contents of cart.
+func (app *application) writeCart(w http.ResponseWriter, r *http.Request, cart *database.Cart) {
+	contents, err := app.getCartContents(cart)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data, err := app.newCartResponse(cart, contents)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// checkCartItem adds field errors if quantity of product can not be put in a
+// cart with the given contents.
+func checkCartItem(v *validator.Validator, contents *cartContents, product *database.Product, quantity int) {
+	v.CheckField(product.Active, "ProductID", "ProductID must be an active product")
+	v.CheckField(validator.Between(quantity, 1, database.MaxCartItemQuantity), "Quantity", fmt.Sprintf("Quantity must be between 1 and %d", database.MaxCartItemQuantity))
+
+	currency := contents.currency()
+	v.CheckField(currency == "" || currency == product.Currency, "ProductID", fmt.Sprintf("ProductID must be a product priced in %s like the rest of the cart", currency))
+
+	if contents.quantity(product.ID) == 0 {
+		v.CheckField(len(contents.items) < database.MaxCartItems, "ProductID", fmt.Sprintf("Cart must not hold more than %d products", database.MaxCartItems))
+	}
+
+	available := 0
+	if level := contents.levels[product.ID]; level != nil {
+		available = level.Available
+	}
+
+	v.CheckField(quantity <= available, "Quantity", fmt.Sprintf("Only %d available", available))
+}
+
+// checkCheckout adds errors if a cart with the given contents can not be
+// checked out, and returns the stock its items need.
+func checkCheckout(v *validator.Validator, contents *cartContents) []database.StockItem {
+	v.Check(len(contents.items) > 0, "Cart is empty")
+
+	currency := contents.currency()
+	items := make([]database.StockItem, len(contents.items))
+
+	for i, item := range contents.items {
+		product := contents.products[item.ProductID]
+
+		v.Check(product.Active, fmt.Sprintf("%s is no longer for sale", product.SKU))
+		v.Check(product.Currency == currency, fmt.Sprintf("%s is not priced in %s", product.SKU, currency))
+
+		items[i] = database.StockItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+
+	return items
+}
+
+// insufficientStock responds to a product running short of stock while a
+// cart is checked out.
+func (app *application) insufficientStock(w http.ResponseWriter, r *http.Request, v validator.Validator, product *database.Product) {
+	level, err := app.db.GetInventoryLevel(product.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v.AddError(fmt.Sprintf("Only %d of %s available", level.Available, product.SKU))
+	app.failedValidation(w, r, v)
+}
+
+func (app *application) getCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := app.findCart(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// addCartItem adds to the quantity of a product in the cart, creating the
+// cart if there is none. Changing the cart releases any stock it had reserved.
+func (app *application) addCartItem(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ProductID int                 `json:"ProductID"`
+		Quantity  int                 `json:"Quantity"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
+
+	input.Validator.CheckField(input.ProductID != 0, "ProductID", "ProductID is required")
+	input.Validator.CheckField(validator.Between(input.Quantity, 1, database.MaxCartItemQuantity), "Quantity", fmt.Sprintf("Quantity must be between 1 and %d", database.MaxCartItemQuantity))
+
+	product, err := app.db.GetProduct(input.ProductID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(product != nil, "ProductID", "ProductID must be an active product")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	cart, err := app.findOrCreateCart(w, r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.db.ReleaseReservation(database.CartReservation(cart.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	contents, err := app.getCartContents(cart)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if _, ok := contents.levels[product.ID]; !ok {
+		contents.levels[product.ID], err = app.db.GetInventoryLevel(product.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	quantity := contents.quantity(product.ID) + input.Quantity
+
+	checkCartItem(&input.Validator, contents, product, quantity)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	// The cart can change between the checks above and adding the item, so
+	// the limits are checked again as the quantity is added
+	err = app.db.AddCartItem(cart.ID, product.ID, input.Quantity)
+
+	var stockErr *database.InsufficientStockError
+
+	switch {
+	case errors.Is(err, database.ErrCartItemQuantity):
+		input.Validator.AddFieldError("Quantity", fmt.Sprintf("Quantity must be between 1 and %d", database.MaxCartItemQuantity))
+	case errors.Is(err, database.ErrCartFull):
+		input.Validator.AddFieldError("ProductID", fmt.Sprintf("Cart must not hold more than %d products", database.MaxCartItems))
+	case errors.Is(err, database.ErrCartCurrency):
+		input.Validator.AddFieldError("ProductID", "ProductID must be a product priced in the same currency as the rest of the cart")
+	case errors.As(err, &stockErr):
+		level, err := app.db.GetInventoryLevel(product.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		input.Validator.AddFieldError("Quantity", fmt.Sprintf("Only %d available", level.Available))
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// getCartItemParam returns the cart and the product whose ID is in the URL,
+// or nils if either does not exist or the product is not in the cart.
+func (app *application) getCartItemParam(r *http.Request) (*database.Cart, *cartContents, *database.Product, error) {
+	productID, err := strconv.Atoi(flow.Param(r.Context(), "id"))
+	if err != nil {
+		return nil, nil, nil, nil
+	}
+
+	cart, err := app.findCart(r)
+	if err != nil || cart == nil {
+		return nil, nil, nil, err
+	}
+
+	contents, err := app.getCartContents(cart)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	product := contents.products[productID]
+	if product == nil {
+		return nil, nil, nil, nil
+	}
+
+	return cart, contents, product, nil
+}
+
+func (app *application) updateCartItem(w http.ResponseWriter, r *http.Request) {
+	cart, contents, product, err := app.getCartItemParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	var input struct {
+		Quantity  int                 `json:"Quantity"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err = request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	err = app.db.ReleaseReservation(database.CartReservation(cart.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	contents.levels[product.ID], err = app.db.GetInventoryLevel(product.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The product's own quantity does not count towards the cart's limits
+	others := &cartContents{products: contents.products, levels: contents.levels}
+	for _, item := range contents.items {
+		if item.ProductID != product.ID {
+			others.items = append(others.items, item)
+		}
+	}
+
+	checkCartItem(&input.Validator, others, product, input.Quantity)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	// The cart or the stock can change between the checks above and setting
+	// the quantity, so the limits are checked again as it is set
+	err = app.db.SetCartItem(cart.ID, product.ID, input.Quantity)
+
+	var stockErr *database.InsufficientStockError
+
+	switch {
+	case errors.Is(err, database.ErrCartItemQuantity):
+		input.Validator.AddFieldError("Quantity", fmt.Sprintf("Quantity must be between 1 and %d", database.MaxCartItemQuantity))
+	case errors.Is(err, database.ErrCartFull):
+		input.Validator.AddFieldError("ProductID", fmt.Sprintf("Cart must not hold more than %d products", database.MaxCartItems))
+	case errors.Is(err, database.ErrCartCurrency):
+		input.Validator.AddFieldError("ProductID", "ProductID must be a product priced in the same currency as the rest of the cart")
+	case errors.As(err, &stockErr):
+		level, err := app.db.GetInventoryLevel(product.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		input.Validator.AddFieldError("Quantity", fmt.Sprintf("Only %d available", level.Available))
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+func (app *application) removeCartItem(w http.ResponseWriter, r *http.Request) {
+	cart, _, product, err := app.getCartItemParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.db.ReleaseReservation(database.CartReservation(cart.ID))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_, err = app.db.DeleteCartItem(cart.ID, product.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
+
+// checkoutCart reserves the stock for everything in the cart for
+// INVENTORY_RESERVATION_TTL, so that it can be ordered without anyone else
+// buying it first. Checking out again extends the reservation.
+func (app *application) checkoutCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := app.findCart(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	contents, err := app.getCartContents(cart)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+
+	items := checkCheckout(&v, contents)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	expires := time.Now().Add(app.config.inventory.reservationTTL)
+
+	err = app.db.ReserveStock(database.CartReservation(cart.ID), items, expires)
+
+	var stockErr *database.InsufficientStockError
+
+	switch {
+	case errors.As(err, &stockErr):
+		app.insufficientStock(w, r, v, contents.products[stockErr.ProductID])
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeCart(w, r, cart)
+}
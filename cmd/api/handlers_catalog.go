@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+// catalogStats maps the stat names accepted in query strings to their names
+// in the catalog.
+var catalogStats = map[string]string{
+	"hp":              "hp",
+	"attack":          "attack",
+	"defense":         "defense",
+	"special_attack":  "special-attack",
+	"special_defense": "special-defense",
+	"speed":           "speed",
+}
+
+// catalogFilterParams are the query string parameters that make getPokemons
+// answer from the local catalog instead of passing the request upstream.
+func catalogFilterParams() []string {
+	params := []string{"type", "ability", "generation", "sort"}
+
+	for stat := range catalogStats {
+		params = append(params, "min_"+stat, "max_"+stat)
+	}
+
+	return params
+}
+
+func hasCatalogFilters(query url.Values) bool {
+	for _, param := range catalogFilterParams() {
+		if query.Has(param) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getCatalogPokemons answers a filtered and sorted /pokemon request from the
+// catalog, in the same shape and with the same kind of links as the upstream
+// list.
+func (app *application) getCatalogPokemons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var v validator.Validator
+
+	intParam := func(key string, defaultValue int) int {
+		if !query.Has(key) {
+			return defaultValue
+		}
+
+		value, err := strconv.Atoi(query.Get(key))
+		if err != nil {
+			v.AddFieldError(key, "Must be an integer")
+		}
+
+		return value
+	}
+
+	filter := database.CatalogFilter{
+		Type:       strings.ToLower(query.Get("type")),
+		Ability:    strings.ToLower(query.Get("ability")),
+		Generation: intParam("generation", 0),
+		MinStats:   map[string]int{},
+		MaxStats:   map[string]int{},
+		Offset:     intParam("offset", 0),
+		Limit:      intParam("limit", 20),
+	}
+
+	for param, stat := range catalogStats {
+		if query.Has("min_" + param) {
+			filter.MinStats[stat] = intParam("min_"+param, 0)
+			v.CheckField(filter.MinStats[stat] >= 0, "min_"+param, "Must be zero or greater")
+		}
+		if query.Has("max_" + param) {
+			filter.MaxStats[stat] = intParam("max_"+param, 0)
+			v.CheckField(filter.MaxStats[stat] >= 0, "max_"+param, "Must be zero or greater")
+		}
+	}
+
+	sortKey := query.Get("sort")
+	filter.Descending = strings.HasPrefix(sortKey, "-")
+	sortKey = strings.TrimPrefix(sortKey, "-")
+
+	sortKeys := []string{"", "id", "name"}
+	for param := range catalogStats {
+		sortKeys = append(sortKeys, param)
+	}
+
+	if validator.In(sortKey, sortKeys...) {
+		filter.Sort = sortKey
+		if stat, ok := catalogStats[sortKey]; ok {
+			filter.Sort = stat
+		}
+	} else {
+		v.AddFieldError("sort", "Must be id, name or a stat (hp, attack, defense, special_attack, special_defense, speed), optionally prefixed with - for descending order")
+	}
+
+	v.CheckField(query.Get("generation") == "" || validator.Between(filter.Generation, 1, pokemon.MaxGeneration), "generation", fmt.Sprintf("Must be between 1 and %d", pokemon.MaxGeneration))
+	v.CheckField(filter.Offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(filter.Limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	for _, resource := range []struct{ param, table, value string }{
+		{"type", "types", filter.Type},
+		{"ability", "abilities", filter.Ability},
+	} {
+		if resource.value == "" {
+			continue
+		}
+
+		exists, err := app.db.CatalogResourceExists(resource.table, resource.value)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		v.CheckField(exists, resource.param, fmt.Sprintf("Must be a known %s", resource.param))
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	results, count, err := app.db.FilterCatalogPokemon(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := pokemon.PokemonList{
+		Count:   count,
+		Results: make([]pokemon.Results, len(results)),
+	}
+
+	for i, result := range results {
+		data.Results[i] = pokemon.Results{
+			Name: result.Name,
+			URL:  app.pokemon.StoreURL(fmt.Sprintf("/pokemon/%d", result.ID)),
+		}
+	}
+
+	pageURL := func(offset int) string {
+		pageQuery := r.URL.Query()
+		pageQuery.Set("offset", strconv.Itoa(offset))
+		pageQuery.Set("limit", strconv.Itoa(filter.Limit))
+
+		return app.pokemon.StoreURL("/pokemon?" + pageQuery.Encode())
+	}
+
+	if filter.Offset+filter.Limit < count {
+		data.Next = pageURL(filter.Offset + filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		previousOffset := filter.Offset - filter.Limit
+		if previousOffset < 0 {
+			previousOffset = 0
+		}
+		data.Previous = pageURL(previousOffset)
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/request"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+// getSKUParam returns the product whose SKU is in the URL, or nil if there is
+// none.
+func (app *application) getSKUParam(r *http.Request) (*database.Product, error) {
+	return app.db.GetProductBySKU(strings.ToUpper(flow.Param(r.Context(), "sku")))
+}
+
+func (app *application) listInventory(w http.ResponseWriter, r *http.Request) {
+	offset := getURLQueryParamInt(r, "offset", 0)
+	limit := getURLQueryParamInt(r, "limit", 20)
+
+	var v validator.Validator
+
+	v.CheckField(offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	levels, count, err := app.db.ListInventoryLevels(offset, limit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Count":   count,
+		"Offset":  offset,
+		"Limit":   limit,
+		"Results": levels,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getInventory(w http.ResponseWriter, r *http.Request) {
+	product, err := app.getSKUParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	level, err := app.db.GetInventoryLevel(product.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, level)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// adjustInventory changes the stock of a SKU either by a Delta, e.g. -2 for
+// damaged goods, or to a Set count, e.g. after a stock take. The change is
+// recorded in the ledger against the admin making it.
+func (app *application) adjustInventory(w http.ResponseWriter, r *http.Request) {
+	product, err := app.getSKUParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	var input struct {
+		Delta     *int                `json:"Delta"`
+		Set       *int                `json:"Set"`
+		Reason    string              `json:"Reason"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err = request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Reason = strings.TrimSpace(input.Reason)
+
+	input.Validator.Check(input.Delta != nil || input.Set != nil, "Either Delta or Set is required")
+	input.Validator.Check(input.Delta == nil || input.Set == nil, "Only one of Delta or Set may be given")
+	input.Validator.CheckField(input.Delta == nil || *input.Delta != 0, "Delta", "Delta must not be zero")
+	input.Validator.CheckField(input.Set == nil || *input.Set >= 0, "Set", "Set must be zero or greater")
+	input.Validator.CheckField(validator.NotBlank(input.Reason), "Reason", "Reason is required")
+	input.Validator.CheckField(validator.MaxRunes(input.Reason, 500), "Reason", "Reason must not be more than 500 characters")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	userID := contextGetAuthenticatedUser(r).ID
+
+	var adjustment *database.InventoryAdjustment
+
+	if input.Set != nil {
+		adjustment, err = app.db.SetInventory(product.ID, *input.Set, &userID, input.Reason)
+	} else {
+		adjustment, err = app.db.AdjustInventory(product.ID, *input.Delta, &userID, input.Reason)
+	}
+
+	var stockErr *database.InsufficientStockError
+
+	switch {
+	case errors.As(err, &stockErr):
+		input.Validator.AddFieldError("Delta", "Delta must not take stock below zero")
+		app.failedValidation(w, r, input.Validator)
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	level, err := app.db.GetInventoryLevel(product.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Adjustment": adjustment,
+		"Inventory":  level,
+	}
+
+	err = response.JSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// listInventoryAdjustments pages through the ledger of the SKU in the URL or,
+// if there is none, of every SKU.
+func (app *application) listInventoryAdjustments(w http.ResponseWriter, r *http.Request) {
+	var productID int
+
+	if flow.Param(r.Context(), "sku") != "" {
+		product, err := app.getSKUParam(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if product == nil {
+			app.notFound(w, r)
+			return
+		}
+
+		productID = product.ID
+	}
+
+	offset := getURLQueryParamInt(r, "offset", 0)
+	limit := getURLQueryParamInt(r, "limit", 20)
+
+	var v validator.Validator
+
+	v.CheckField(offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	adjustments, count, err := app.db.ListInventoryAdjustments(productID, offset, limit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Count":   count,
+		"Offset":  offset,
+		"Limit":   limit,
+		"Results": adjustments,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/request"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+type orderResponse struct {
+	*database.Order
+	Items       []*database.OrderItem
+	History     []*database.OrderHistoryEntry
+	Payments    []*database.Payment
+	Transitions []string
+}
+
+func (app *application) newOrderResponse(order *database.Order) (orderResponse, error) {
+	items, err := app.db.GetOrderItems(order.ID)
+	if err != nil {
+		return orderResponse{}, err
+	}
+
+	history, err := app.db.GetOrderHistory(order.ID)
+	if err != nil {
+		return orderResponse{}, err
+	}
+
+	payments, err := app.db.GetOrderPayments(order.ID)
+	if err != nil {
+		return orderResponse{}, err
+	}
+
+	transitions := database.OrderTransitions(order.Status)
+	if transitions == nil {
+		transitions = []string{}
+	}
+
+	return orderResponse{Order: order, Items: items, History: history, Payments: payments, Transitions: transitions}, nil
+}
+
+func (app *application) writeOrder(w http.ResponseWriter, r *http.Request, status int, order *database.Order) {
+	data, err := app.newOrderResponse(order)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, status, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getOrderParam returns the order whose ID is in the URL, or nil if there is
+// none.
+func (app *application) getOrderParam(r *http.Request) (*database.Order, error) {
+	id, err := strconv.Atoi(flow.Param(r.Context(), "id"))
+	if err != nil {
+		return nil, nil
+	}
+
+	return app.db.GetOrder(id)
+}
+
+// createOrder places an order for everything in the authenticated user's
+// cart at the current prices and empties the cart. Stock the cart reserved
+// at checkout is used first.
+func (app *application) createOrder(w http.ResponseWriter, r *http.Request) {
+	user := contextGetAuthenticatedUser(r)
+
+	cart, err := app.db.GetCartByUserID(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	contents, err := app.getCartContents(cart)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var v validator.Validator
+
+	checkCheckout(&v, contents)
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	items := make([]database.OrderItem, len(contents.items))
+
+	for i, item := range contents.items {
+		product := contents.products[item.ProductID]
+
+		items[i] = database.OrderItem{
+			ProductID:   product.ID,
+			SKU:         product.SKU,
+			Name:        product.Name,
+			PokemonID:   product.PokemonID,
+			PokemonName: product.PokemonName,
+			Variant:     product.Variant,
+			Level:       product.Level,
+			UnitPrice:   product.Price,
+			Quantity:    item.Quantity,
+			Subtotal:    product.Price * int64(item.Quantity),
+		}
+	}
+
+	order, err := app.db.CreateOrder(user.ID, cart.ID, contents.currency(), items, database.CartReservation(cart.ID))
+
+	var stockErr *database.InsufficientStockError
+
+	switch {
+	case errors.As(err, &stockErr):
+		app.insufficientStock(w, r, v, contents.products[stockErr.ProductID])
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusCreated, order)
+}
+
+// listOrders pages through orders, newest first. Users only see their own,
+// while admins can see and search everyone's.
+func (app *application) listOrders(w http.ResponseWriter, r *http.Request, admin bool) {
+	query := r.URL.Query()
+
+	filter := database.OrderFilter{
+		Status: query.Get("status"),
+		Offset: getURLQueryParamInt(r, "offset", 0),
+		Limit:  getURLQueryParamInt(r, "limit", 20),
+	}
+
+	var v validator.Validator
+
+	if admin {
+		filter.Email = query.Get("email")
+		filter.SKU = strings.ToUpper(query.Get("sku"))
+
+		if query.Has("user_id") {
+			var err error
+			filter.UserID, err = strconv.Atoi(query.Get("user_id"))
+			v.CheckField(err == nil && filter.UserID > 0, "user_id", "Must be a user ID")
+		}
+	} else {
+		filter.UserID = contextGetAuthenticatedUser(r).ID
+	}
+
+	v.CheckField(filter.Status == "" || validator.In(filter.Status, database.OrderStatuses...), "status", "Must be one of "+strings.Join(database.OrderStatuses, ", "))
+	v.CheckField(filter.Offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(filter.Limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	orders, count, err := app.db.ListOrders(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Count":   count,
+		"Offset":  filter.Offset,
+		"Limit":   filter.Limit,
+		"Results": orders,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getOrders(w http.ResponseWriter, r *http.Request) {
+	app.listOrders(w, r, false)
+}
+
+func (app *application) getAllOrders(w http.ResponseWriter, r *http.Request) {
+	app.listOrders(w, r, true)
+}
+
+// getOrder returns one of the authenticated user's orders. Other users'
+// orders are reported as not found.
+func (app *application) getOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := app.getOrderParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if order == nil || order.UserID != contextGetAuthenticatedUser(r).ID {
+		app.notFound(w, r)
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, order)
+}
+
+func (app *application) getOrderByID(w http.ResponseWriter, r *http.Request) {
+	order, err := app.getOrderParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if order == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, order)
+}
+
+func (app *application) transitionOrder(w http.ResponseWriter, r *http.Request) {
+	order, err := app.getOrderParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if order == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	var input struct {
+		Status    string              `json:"Status"`
+		Note      string              `json:"Note"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err = request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Note = strings.TrimSpace(input.Note)
+
+	input.Validator.CheckField(input.Status != "", "Status", "Status is required")
+	input.Validator.CheckField(len(input.Note) <= 500, "Note", "Note must not be more than 500 characters")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	user := contextGetAuthenticatedUser(r)
+
+	err = app.db.TransitionOrder(order.ID, order.Status, input.Status, &user.ID, input.Note)
+
+	var transitionErr *database.InvalidTransitionError
+
+	switch {
+	case errors.As(err, &transitionErr):
+		transitions := database.OrderTransitions(order.Status)
+
+		if len(transitions) == 0 {
+			input.Validator.AddFieldError("Status", fmt.Sprintf("Status of a %s order can not be changed", order.Status))
+		} else {
+			input.Validator.AddFieldError("Status", fmt.Sprintf("Status of a %s order can only change to %s", order.Status, strings.Join(transitions, " or ")))
+		}
+
+		app.failedValidation(w, r, input.Validator)
+		return
+	case errors.Is(err, database.ErrOrderStatusChanged):
+		app.editConflict(w, r)
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Payments are only refunded once the order has moved, so that money is
+	// never paid back for an order that is not cancelled or refunded. Refunds
+	// that fail are left due and shown with the order's payments
+	if app.payments != nil && validator.In(input.Status, database.OrderCancelled, database.OrderRefunded) {
+		orderPayments, err := app.db.GetOrderPayments(order.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = app.refundPayments(r.Context(), orderPayments)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	order, err = app.db.GetOrder(order.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, order)
+}
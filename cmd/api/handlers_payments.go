@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/payments"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+// maxWebhookBytes is the largest webhook payload that is accepted.
+const maxWebhookBytes = 64 * 1024
+
+// orderPaymentReference is what an order's payments are taken for with the
+// payment provider.
+func orderPaymentReference(orderID int) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// createPayment starts paying for one of the authenticated user's pending
+// orders and returns the client secret the customer completes the payment
+// with. Calling it again returns the same payment until it fails.
+func (app *application) createPayment(w http.ResponseWriter, r *http.Request) {
+	order, err := app.getOrderParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if order == nil || order.UserID != contextGetAuthenticatedUser(r).ID {
+		app.notFound(w, r)
+		return
+	}
+
+	var v validator.Validator
+
+	v.Check(order.Status == database.OrderPending, fmt.Sprintf("Order is %s, only pending orders can be paid", order.Status))
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	intent, err := app.payments.CreateIntent(r.Context(), orderPaymentReference(order.ID), order.Total, order.Currency)
+	if err != nil {
+		app.badGateway(w, r, err)
+		return
+	}
+
+	payment := &database.Payment{
+		OrderID:  order.ID,
+		Provider: app.payments.Name(),
+		IntentID: intent.ID,
+		Amount:   intent.Amount,
+		Currency: intent.Currency,
+		Status:   intent.Status,
+	}
+
+	err = app.db.UpsertPayment(payment)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"Payment":      payment,
+		"ClientSecret": intent.ClientSecret,
+	}
+
+	err = response.JSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// paymentWebhook receives event notifications from the payment provider.
+// Providers redeliver events until they are acknowledged, so events that
+// were processed before are acknowledged without being processed again.
+func (app *application) paymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	event, err := app.payments.VerifyWebhook(payload, r.Header)
+	switch {
+	case errors.Is(err, payments.ErrInvalidSignature), errors.Is(err, payments.ErrInvalidEvent):
+		app.badRequest(w, r, err)
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	provider := app.payments.Name()
+
+	// Events are claimed before they are processed, so that deliveries of the
+	// same event that arrive together are only processed once
+	claimed, err := app.db.InsertPaymentEvent(provider, event.ID, event.Type, event.IntentID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if claimed {
+		err = app.processPaymentEvent(r.Context(), event)
+		if err != nil {
+			// The provider redelivers events that are not acknowledged, and the
+			// redelivery has to be processed
+			deleteErr := app.db.DeletePaymentEvent(provider, event.ID)
+			if deleteErr != nil {
+				app.logger.Error(deleteErr.Error(), "event", event.ID)
+			}
+
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"Received": true, "Duplicate": !claimed})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// processPaymentEvent brings the payment and order an event is about up to
+// date. It is safe to call more than once for the same event.
+func (app *application) processPaymentEvent(ctx context.Context, event *payments.Event) error {
+	payment, err := app.db.GetPaymentByIntentID(app.payments.Name(), event.IntentID)
+	if err != nil {
+		return err
+	}
+
+	if payment == nil {
+		app.logger.Warn("payment event for unknown intent", "event", event.ID, "intent", event.IntentID)
+		return nil
+	}
+
+	note := fmt.Sprintf("Payment %s %s", payment.IntentID, event.Type)
+
+	// Events can arrive late and out of order, so each only moves a payment
+	// on from the status it expects
+
+	switch event.Type {
+	case payments.EventAuthorized:
+		// The payment and its order are updated one after the other, so the
+		// redelivery of an event that failed in between finds the payment
+		// succeeded and the order still pending. Orders that have moved on
+		// are left as they are
+		if payment.Status == payments.StatusSucceeded {
+			return app.settleOrder(payment.OrderID, database.OrderPaid, note)
+		}
+
+		if payment.Status != payments.StatusRequiresCapture {
+			return nil
+		}
+
+		order, err := app.db.GetOrder(payment.OrderID)
+		if err != nil {
+			return err
+		}
+
+		// Authorisations for orders that were cancelled in the meantime are
+		// released rather than captured
+		var intent *payments.Intent
+		if order != nil && order.Status == database.OrderPending {
+			intent, err = app.payments.Capture(ctx, payment.IntentID)
+		} else {
+			intent, err = app.payments.Refund(ctx, payment.IntentID)
+		}
+
+		switch {
+		case errors.Is(err, payments.ErrInvalidStatus):
+			// The intent moved on already, and the provider notifies us of
+			// how it did with an event of its own
+			return nil
+		case err != nil:
+			return err
+		}
+
+		err = app.db.UpdatePaymentStatus(payment.ID, intent.Status)
+		if err != nil {
+			return err
+		}
+
+		if intent.Status == payments.StatusSucceeded {
+			return app.settleOrder(payment.OrderID, database.OrderPaid, note)
+		}
+	case payments.EventSucceeded:
+		if payment.Status == payments.StatusSucceeded {
+			return app.settleOrder(payment.OrderID, database.OrderPaid, note)
+		}
+
+		if payment.Status != payments.StatusRequiresCapture {
+			return nil
+		}
+
+		intent, err := app.confirmIntent(ctx, event, payments.StatusSucceeded)
+		if err != nil || intent == nil {
+			return err
+		}
+
+		err = app.db.UpdatePaymentStatus(payment.ID, intent.Status)
+		if err != nil {
+			return err
+		}
+
+		return app.settleOrder(payment.OrderID, database.OrderPaid, note)
+	case payments.EventFailed:
+		if payment.Status != payments.StatusRequiresCapture {
+			return nil
+		}
+
+		intent, err := app.confirmIntent(ctx, event, payments.StatusFailed)
+		if err != nil || intent == nil {
+			return err
+		}
+
+		return app.db.UpdatePaymentStatus(payment.ID, intent.Status)
+	case payments.EventRefunded:
+		if payment.Status == payments.StatusRefunded {
+			return app.settleOrder(payment.OrderID, database.OrderRefunded, note)
+		}
+
+		if !validator.In(payment.Status, payments.StatusSucceeded, payments.StatusRequiresCapture) {
+			return nil
+		}
+
+		intent, err := app.confirmIntent(ctx, event, payments.StatusRefunded, payments.StatusCancelled)
+		if err != nil || intent == nil {
+			return err
+		}
+
+		err = app.db.UpdatePaymentStatus(payment.ID, intent.Status)
+		if err != nil {
+			return err
+		}
+
+		return app.settleOrder(payment.OrderID, database.OrderRefunded, note)
+	default:
+		app.logger.Info("ignored payment event", "event", event.ID, "type", event.Type)
+	}
+
+	return nil
+}
+
+// confirmIntent returns the intent an event is about as the provider has it
+// now, or nil if the intent is not in one of the statuses the event implies.
+// The event is logged and otherwise ignored in that case.
+func (app *application) confirmIntent(ctx context.Context, event *payments.Event, statuses ...string) (*payments.Intent, error) {
+	intent, err := app.payments.GetIntent(ctx, event.IntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validator.In(intent.Status, statuses...) {
+		app.logger.Warn("payment event does not match intent", "event", event.ID, "type", event.Type, "intent", intent.ID, "status", intent.Status)
+		return nil, nil
+	}
+
+	return intent, nil
+}
+
+// settleOrder moves an order to status to on behalf of the store. Orders
+// that are in status to already, or can not move to it, are left as they
+// are.
+func (app *application) settleOrder(orderID int, to, note string) error {
+	for {
+		order, err := app.db.GetOrder(orderID)
+		if err != nil || order == nil {
+			return err
+		}
+
+		if !database.CanTransitionOrder(order.Status, to) {
+			return nil
+		}
+
+		err = app.db.TransitionOrder(order.ID, order.Status, to, nil, note)
+		if !errors.Is(err, database.ErrOrderStatusChanged) {
+			return err
+		}
+	}
+}
+
+// refundPayments refunds the payments in orderPayments that are due a
+// refund, releasing those that have only been authorised, and updates their
+// status to match. Payments that can not be refunded keep their refund due
+// and record why, so that retryRefunds tries them again. It returns how many
+// payments could not be refunded.
+func (app *application) refundPayments(ctx context.Context, orderPayments []*database.Payment) (int, error) {
+	failed := 0
+
+	for _, payment := range orderPayments {
+		if !payment.RefundDue || payment.Provider != app.payments.Name() {
+			continue
+		}
+
+		intent, err := app.payments.Refund(ctx, payment.IntentID)
+		if errors.Is(err, payments.ErrInvalidStatus) {
+			// The intent may have been refunded or released already, in
+			// which case there is nothing left to do but record it
+			intent, err = app.payments.GetIntent(ctx, payment.IntentID)
+			if err == nil && !validator.In(intent.Status, payments.StatusRefunded, payments.StatusCancelled) {
+				err = fmt.Errorf("payments: intent is %s", intent.Status)
+			}
+		}
+
+		if err != nil {
+			failed++
+
+			app.logger.Warn("payment refund failed", "payment", payment.ID, "intent", payment.IntentID, "error", err.Error())
+
+			err = app.db.SetPaymentRefundError(payment.ID, err.Error())
+			if err != nil {
+				return failed, err
+			}
+
+			continue
+		}
+
+		err = app.db.UpdatePaymentStatus(payment.ID, intent.Status)
+		if err != nil {
+			return failed, err
+		}
+	}
+
+	return failed, nil
+}
+
+// retryRefunds refunds the payments that are still due a refund every
+// interval until ctx is done.
+func (app *application) retryRefunds(ctx context.Context, interval time.Duration) {
+	defer app.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			duePayments, err := app.db.GetRefundDuePayments(app.payments.Name())
+			if err != nil {
+				app.logger.Error(err.Error())
+				continue
+			}
+
+			if len(duePayments) == 0 {
+				continue
+			}
+
+			failed, err := app.refundPayments(ctx, duePayments)
+			if err != nil {
+				app.logger.Error(err.Error())
+				continue
+			}
+
+			app.logger.Info("retried payment refunds", "refunded", len(duePayments)-failed, "failed", failed)
+		}
+	}
+}
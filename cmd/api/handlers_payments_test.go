@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/payments"
+
+	"github.com/pascaldekloe/jwt"
+	"golang.org/x/exp/slog"
+)
+
+func newTestApplication(t *testing.T) (*application, *payments.Simulator) {
+	t.Helper()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "db.sqlite"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	simulator := payments.NewSimulator("test-secret")
+
+	app := &application{
+		db:       db,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		payments: simulator,
+	}
+
+	app.config.env = "test"
+	app.config.baseURL = "http://localhost:4444"
+	app.config.jwt.secretKey = "test-jwt-secret"
+
+	return app, simulator
+}
+
+// testRequest sends a request to the application's routes as the user with
+// the given ID, or anonymously if userID is 0, and decodes the JSON response
+// into dst if it is not nil.
+func testRequest(t *testing.T, app *application, method, url string, header http.Header, body []byte, userID int, dst any) int {
+	t.Helper()
+
+	r := httptest.NewRequest(method, url, bytes.NewReader(body))
+
+	for key, values := range header {
+		r.Header[key] = values
+	}
+
+	if userID != 0 {
+		var claims jwt.Claims
+		claims.Subject = strconv.Itoa(userID)
+		claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+		claims.Issuer = app.config.baseURL
+		claims.Audiences = []string{app.config.baseURL}
+
+		token, err := claims.HMACSign(jwt.HS256, []byte(app.config.jwt.secretKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Authorization", "Bearer "+string(token))
+	}
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+
+	if dst != nil {
+		err := json.Unmarshal(w.Body.Bytes(), dst)
+		if err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, url, w.Body.String(), err)
+		}
+	}
+
+	return w.Code
+}
+
+// insertTestOrder stores an admin, who is the user with ID 1, a user, and a
+// pending order of the user's for 2 of a product with 10 in stock.
+func insertTestOrder(t *testing.T, app *application) (adminID, userID int, product *database.Product, order *database.Order) {
+	t.Helper()
+
+	adminID, err := app.db.InsertUser("admin@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err = app.db.InsertUser("user@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product = &database.Product{SKU: "PIKACHU", PokemonID: 25, PokemonName: "pikachu", Name: "Pikachu", Price: 1000, Currency: "USD", Variant: database.VariantNormal, Level: 5, Active: true}
+
+	err = app.db.InsertProduct(product)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.db.SetInventory(product.ID, 10, &adminID, "Initial stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []database.OrderItem{{ProductID: product.ID, SKU: product.SKU, Name: product.Name, UnitPrice: product.Price, Quantity: 2, Subtotal: 2 * product.Price}}
+
+	order, err = app.db.CreateOrder(userID, 0, "USD", items, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return adminID, userID, product, order
+}
+
+func TestPaymentFlow(t *testing.T) {
+	app, simulator := newTestApplication(t)
+
+	adminID, userID, product, order := insertTestOrder(t, app)
+
+	// checkOrder fails the test unless the order and its only payment have
+	// the given statuses, and returns the order's history
+	checkOrder := func(step, orderStatus, paymentStatus string) []*database.OrderHistoryEntry {
+		t.Helper()
+
+		var got orderResponse
+
+		code := testRequest(t, app, http.MethodGet, fmt.Sprintf("/orders/%d", order.ID), nil, nil, userID, &got)
+		if code != http.StatusOK {
+			t.Fatalf("%s: getting the order responded %d", step, code)
+		}
+
+		if got.Status != orderStatus {
+			t.Errorf("%s: order is %q; want %q", step, got.Status, orderStatus)
+		}
+
+		if len(got.Payments) != 1 || got.Payments[0].Status != paymentStatus {
+			t.Errorf("%s: payments are %+v; want one that is %q", step, got.Payments, paymentStatus)
+		}
+
+		return got.History
+	}
+
+	var created struct {
+		Payment      database.Payment
+		ClientSecret string
+	}
+
+	code := testRequest(t, app, http.MethodPost, fmt.Sprintf("/orders/%d/payments", order.ID), nil, nil, userID, &created)
+	if code != http.StatusCreated {
+		t.Fatalf("creating the payment responded %d", code)
+	}
+
+	intentID := created.Payment.IntentID
+
+	checkOrder("created", database.OrderPending, payments.StatusRequiresCapture)
+
+	var received struct {
+		Received  bool
+		Duplicate bool
+	}
+
+	payload, header, err := simulator.Webhook(payments.EventAuthorized, intentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", header, payload, 0, &received)
+	if code != http.StatusOK || received.Duplicate {
+		t.Fatalf("authorized webhook responded %d with %+v", code, received)
+	}
+
+	history := checkOrder("authorized", database.OrderPaid, payments.StatusSucceeded)
+
+	// A redelivery of the same event is acknowledged but not processed again
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", header, payload, 0, &received)
+	if code != http.StatusOK || !received.Duplicate {
+		t.Fatalf("redelivered webhook responded %d with %+v", code, received)
+	}
+
+	if redelivered := checkOrder("redelivered", database.OrderPaid, payments.StatusSucceeded); len(redelivered) != len(history) {
+		t.Errorf("redelivered: order history grew from %d to %d entries", len(history), len(redelivered))
+	}
+
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", header, append(payload, ' '), 0, nil)
+	if code != http.StatusBadRequest {
+		t.Errorf("webhook with a bad signature responded %d; want %d", code, http.StatusBadRequest)
+	}
+
+	body := []byte(`{"Status": "refunded", "Note": "Customer changed their mind"}`)
+
+	code = testRequest(t, app, http.MethodPost, fmt.Sprintf("/admin/orders/%d/transitions", order.ID), nil, body, adminID, nil)
+	if code != http.StatusOK {
+		t.Fatalf("refunding the order responded %d", code)
+	}
+
+	checkOrder("refunded", database.OrderRefunded, payments.StatusRefunded)
+
+	intent, err := simulator.GetIntent(context.Background(), intentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if intent.Status != payments.StatusRefunded {
+		t.Errorf("intent is %q after the refund; want %q", intent.Status, payments.StatusRefunded)
+	}
+
+	// The provider's own notification of the refund changes nothing
+	payload, header, err = simulator.Webhook(payments.EventRefunded, intentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", header, payload, 0, &received)
+	if code != http.StatusOK || received.Duplicate {
+		t.Fatalf("refunded webhook responded %d with %+v", code, received)
+	}
+
+	checkOrder("refund notified", database.OrderRefunded, payments.StatusRefunded)
+
+	level, err := app.db.GetInventoryLevel(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if level.OnHand != 10 {
+		t.Errorf("stock on hand is %d after the refund; want 10", level.OnHand)
+	}
+}
+
+func TestRefundRetry(t *testing.T) {
+	app, simulator := newTestApplication(t)
+
+	adminID, _, _, order := insertTestOrder(t, app)
+
+	// A payment the simulator does not know about can not be refunded
+	payment := &database.Payment{OrderID: order.ID, Provider: simulator.Name(), IntentID: "sim_pi_lost", Amount: order.Total, Currency: order.Currency, Status: payments.StatusSucceeded}
+
+	err := app.db.UpsertPayment(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.db.TransitionOrder(order.ID, database.OrderPending, database.OrderPaid, nil, "Paid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"Status": "refunded"}`)
+
+	var got orderResponse
+
+	code := testRequest(t, app, http.MethodPost, fmt.Sprintf("/admin/orders/%d/transitions", order.ID), nil, body, adminID, &got)
+	if code != http.StatusOK {
+		t.Fatalf("refunding the order responded %d", code)
+	}
+
+	if got.Status != database.OrderRefunded {
+		t.Errorf("order is %q after a failed refund; want %q", got.Status, database.OrderRefunded)
+	}
+
+	if len(got.Payments) != 1 || !got.Payments[0].RefundDue || got.Payments[0].RefundError == "" {
+		t.Fatalf("payments are %+v after a failed refund; want one that is still due a refund", got.Payments)
+	}
+
+	simulator.Restore(payments.Intent{ID: payment.IntentID, Reference: orderPaymentReference(order.ID), Amount: payment.Amount, Currency: payment.Currency, Status: payments.StatusSucceeded})
+
+	duePayments, err := app.db.GetRefundDuePayments(simulator.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := app.refundPayments(context.Background(), duePayments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed != 0 {
+		t.Errorf("%d refunds failed on retry; want none", failed)
+	}
+
+	payment, err = app.db.GetPaymentByIntentID(simulator.Name(), payment.IntentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payment.Status != payments.StatusRefunded || payment.RefundDue || payment.RefundError != "" {
+		t.Errorf("payment is %+v after the retry; want it refunded and no longer due", payment)
+	}
+}
+
+func TestPaymentRedeliverySettlesOrder(t *testing.T) {
+	app, simulator := newTestApplication(t)
+
+	_, userID, _, order := insertTestOrder(t, app)
+
+	var created struct {
+		Payment database.Payment
+	}
+
+	code := testRequest(t, app, http.MethodPost, fmt.Sprintf("/orders/%d/payments", order.ID), nil, nil, userID, &created)
+	if code != http.StatusCreated {
+		t.Fatalf("creating the payment responded %d", code)
+	}
+
+	// An earlier delivery captured the payment, and failed before the order
+	// was marked paid
+	intent, err := simulator.Capture(context.Background(), created.Payment.IntentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.db.UpdatePaymentStatus(created.Payment.ID, intent.Status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, header, err := simulator.Webhook(payments.EventAuthorized, intent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", header, payload, 0, nil)
+	if code != http.StatusOK {
+		t.Fatalf("redelivered webhook responded %d", code)
+	}
+
+	order, err = app.db.GetOrder(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if order.Status != database.OrderPaid {
+		t.Errorf("order is %q after the redelivery; want %q", order.Status, database.OrderPaid)
+	}
+}
+
+func TestWithoutPaymentProvider(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.payments = nil
+
+	adminID, userID, _, order := insertTestOrder(t, app)
+
+	code := testRequest(t, app, http.MethodPost, fmt.Sprintf("/orders/%d/payments", order.ID), nil, nil, userID, nil)
+	if code != http.StatusNotFound {
+		t.Errorf("creating a payment responded %d; want %d", code, http.StatusNotFound)
+	}
+
+	code = testRequest(t, app, http.MethodPost, "/payments/webhook", nil, []byte(`{}`), 0, nil)
+	if code != http.StatusNotFound {
+		t.Errorf("webhook responded %d; want %d", code, http.StatusNotFound)
+	}
+
+	body := []byte(`{"Status": "cancelled"}`)
+
+	code = testRequest(t, app, http.MethodPost, fmt.Sprintf("/admin/orders/%d/transitions", order.ID), nil, body, adminID, nil)
+	if code != http.StatusOK {
+		t.Errorf("cancelling the order responded %d; want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/request"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+var (
+	rgxSKU      = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+	rgxCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// maxProductPrice keeps prices, and the order totals made from them, well
+// clear of integer overflow.
+const maxProductPrice = 100_000_000
+
+// productResponse is a product as served by the API, with a link to its
+// Pokémon on the store.
+type productResponse struct {
+	*database.Product
+	PokemonURL string
+}
+
+func (app *application) newProductResponse(product *database.Product) productResponse {
+	return productResponse{
+		Product:    product,
+		PokemonURL: app.pokemon.StoreURL(fmt.Sprintf("/pokemon/%d", product.PokemonID)),
+	}
+}
+
+func validateProduct(v *validator.Validator, product *database.Product) {
+	v.CheckField(validator.NotBlank(product.SKU), "SKU", "SKU is required")
+	v.CheckField(validator.MaxRunes(product.SKU, 64), "SKU", "SKU must not be more than 64 characters")
+	v.CheckField(validator.Matches(product.SKU, rgxSKU), "SKU", "SKU must be letters and digits, separated by single hyphens")
+	v.CheckField(validator.MaxRunes(product.Name, 200), "Name", "Name must not be more than 200 characters")
+	v.CheckField(validator.MaxRunes(product.Description, 2000), "Description", "Description must not be more than 2000 characters")
+	v.CheckField(validator.Between(product.Price, 0, maxProductPrice), "Price", fmt.Sprintf("Price must be between 0 and %d", maxProductPrice))
+	v.CheckField(validator.Matches(product.Currency, rgxCurrency), "Currency", "Currency must be a three letter ISO 4217 code")
+	v.CheckField(validator.In(product.Variant, database.VariantNormal, database.VariantShiny), "Variant", "Variant must be normal or shiny")
+	v.CheckField(validator.Between(product.Level, 1, 100), "Level", "Level must be between 1 and 100")
+}
+
+// checkProductSKU adds a field error if another product already uses the
+// product's SKU.
+func (app *application) checkProductSKU(v *validator.Validator, product *database.Product) error {
+	existing, err := app.db.GetProductBySKU(product.SKU)
+	if err != nil {
+		return err
+	}
+
+	v.CheckField(existing == nil || existing.ID == product.ID, "SKU", "SKU is already in use")
+	return nil
+}
+
+// linkProductPokemon looks up the Pokémon named or numbered nameOrId and
+// links the product to it, adding a field error if there is no such Pokémon.
+func (app *application) linkProductPokemon(v *validator.Validator, product *database.Product, nameOrId string) error {
+	p, _, err := app.pokemon.GetSinglePokemon(strings.ToLower(strings.TrimSpace(nameOrId)))
+	switch {
+	case errors.Is(err, cached_http.ErrNotFound):
+		v.AddFieldError("Pokemon", "Pokemon must be the name or ID of a known Pokémon")
+		return nil
+	case err != nil:
+		return err
+	}
+
+	product.PokemonID = p.ID
+	product.PokemonName = p.Name
+	return nil
+}
+
+// defaultProductName names a product after its Pokémon, e.g. "Shiny
+// Mr Mime (Lv. 50)".
+func defaultProductName(product *database.Product) string {
+	words := strings.Split(product.PokemonName, "-")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+
+	name := strings.Join(words, " ")
+	if product.Variant == database.VariantShiny {
+		name = "Shiny " + name
+	}
+
+	return fmt.Sprintf("%s (Lv. %d)", name, product.Level)
+}
+
+func (app *application) createProduct(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SKU         string              `json:"SKU"`
+		Pokemon     string              `json:"Pokemon"`
+		Name        string              `json:"Name"`
+		Description string              `json:"Description"`
+		Price       *int64              `json:"Price"`
+		Currency    string              `json:"Currency"`
+		Variant     string              `json:"Variant"`
+		Level       int                 `json:"Level"`
+		Active      *bool               `json:"Active"`
+		Validator   validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	product := &database.Product{
+		SKU:         strings.ToUpper(strings.TrimSpace(input.SKU)),
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Currency:    strings.ToUpper(input.Currency),
+		Variant:     input.Variant,
+		Level:       input.Level,
+		Active:      true,
+	}
+
+	if input.Price != nil {
+		product.Price = *input.Price
+	}
+	if product.Currency == "" {
+		product.Currency = app.config.store.currency
+	}
+	if product.Variant == "" {
+		product.Variant = database.VariantNormal
+	}
+	if product.Level == 0 {
+		product.Level = 1
+	}
+	if input.Active != nil {
+		product.Active = *input.Active
+	}
+
+	input.Validator.CheckField(input.Price != nil, "Price", "Price is required")
+	input.Validator.CheckField(validator.NotBlank(input.Pokemon), "Pokemon", "Pokemon is required")
+	validateProduct(&input.Validator, product)
+
+	if validator.NotBlank(input.Pokemon) {
+		err = app.linkProductPokemon(&input.Validator, product, input.Pokemon)
+		if err != nil {
+			app.upstreamError(w, r, err)
+			return
+		}
+	}
+
+	err = app.checkProductSKU(&input.Validator, product)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	if product.Name == "" {
+		product.Name = defaultProductName(product)
+	}
+
+	err = app.db.InsertProduct(product)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, app.newProductResponse(product))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getProductParam returns the product whose ID is in the URL, or nil if
+// there is none.
+func (app *application) getProductParam(r *http.Request) (*database.Product, error) {
+	id, err := strconv.Atoi(flow.Param(r.Context(), "id"))
+	if err != nil {
+		return nil, nil
+	}
+
+	return app.db.GetProduct(id)
+}
+
+func (app *application) getProductByID(w http.ResponseWriter, r *http.Request) {
+	product, err := app.getProductParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, app.newProductResponse(product))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// updateProduct changes only the fields present in the request. Clearing the
+// name names the product after its Pokémon again.
+func (app *application) updateProduct(w http.ResponseWriter, r *http.Request) {
+	product, err := app.getProductParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	var input struct {
+		SKU         *string             `json:"SKU"`
+		Pokemon     *string             `json:"Pokemon"`
+		Name        *string             `json:"Name"`
+		Description *string             `json:"Description"`
+		Price       *int64              `json:"Price"`
+		Currency    *string             `json:"Currency"`
+		Variant     *string             `json:"Variant"`
+		Level       *int                `json:"Level"`
+		Active      *bool               `json:"Active"`
+		Validator   validator.Validator `json:"-"`
+	}
+
+	err = request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.SKU != nil {
+		product.SKU = strings.ToUpper(strings.TrimSpace(*input.SKU))
+	}
+	if input.Name != nil {
+		product.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		product.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Price != nil {
+		product.Price = *input.Price
+	}
+	if input.Currency != nil {
+		product.Currency = strings.ToUpper(*input.Currency)
+	}
+	if input.Variant != nil {
+		product.Variant = *input.Variant
+	}
+	if input.Level != nil {
+		product.Level = *input.Level
+	}
+	if input.Active != nil {
+		product.Active = *input.Active
+	}
+
+	validateProduct(&input.Validator, product)
+
+	if input.Pokemon != nil {
+		input.Validator.CheckField(validator.NotBlank(*input.Pokemon), "Pokemon", "Pokemon must not be blank")
+
+		if validator.NotBlank(*input.Pokemon) {
+			err = app.linkProductPokemon(&input.Validator, product, *input.Pokemon)
+			if err != nil {
+				app.upstreamError(w, r, err)
+				return
+			}
+		}
+	}
+
+	err = app.checkProductSKU(&input.Validator, product)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	if product.Name == "" {
+		product.Name = defaultProductName(product)
+	}
+
+	err = app.db.UpdateProduct(product)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, app.newProductResponse(product))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(flow.Param(r.Context(), "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	deleted, err := app.db.DeleteProduct(id)
+	switch {
+	case errors.Is(err, database.ErrProductOrdered):
+		app.errorMessage(w, r, http.StatusConflict, "Product has been ordered and can not be deleted, deactivate it instead", nil)
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !deleted {
+		app.notFound(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listProducts serves both the public and the admin product lists. Only
+// admins see inactive products, and may filter on ?active=.
+func (app *application) listProducts(w http.ResponseWriter, r *http.Request, admin bool) {
+	query := r.URL.Query()
+
+	filter := database.ProductFilter{
+		Variant: query.Get("variant"),
+		Offset:  getURLQueryParamInt(r, "offset", 0),
+		Limit:   getURLQueryParamInt(r, "limit", 20),
+	}
+
+	if pokemonParam := strings.ToLower(query.Get("pokemon")); pokemonParam != "" {
+		if id, err := strconv.Atoi(pokemonParam); err == nil {
+			filter.PokemonID = id
+		} else {
+			filter.PokemonName = pokemonParam
+		}
+	}
+
+	var v validator.Validator
+
+	active := true
+	switch {
+	case !admin:
+		filter.Active = &active
+	case query.Has("active"):
+		var err error
+		active, err = strconv.ParseBool(query.Get("active"))
+		v.CheckField(err == nil, "active", "Must be true or false")
+		filter.Active = &active
+	}
+
+	v.CheckField(filter.Variant == "" || validator.In(filter.Variant, database.VariantNormal, database.VariantShiny), "variant", "Must be normal or shiny")
+	v.CheckField(filter.Offset >= 0, "offset", "Must be zero or greater")
+	v.CheckField(validator.Between(filter.Limit, 1, 100), "limit", "Must be between 1 and 100")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	products, count, err := app.db.ListProducts(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	results := make([]productResponse, len(products))
+	for i, product := range products {
+		results[i] = app.newProductResponse(product)
+	}
+
+	data := map[string]any{
+		"Count":   count,
+		"Offset":  filter.Offset,
+		"Limit":   filter.Limit,
+		"Results": results,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getProducts(w http.ResponseWriter, r *http.Request) {
+	app.listProducts(w, r, false)
+}
+
+func (app *application) getAllProducts(w http.ResponseWriter, r *http.Request) {
+	app.listProducts(w, r, true)
+}
+
+// getActiveProduct serves a single product to the public, hiding inactive
+// ones as if they did not exist.
+func (app *application) getActiveProduct(w http.ResponseWriter, r *http.Request) {
+	product, err := app.getProductParam(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if product == nil || !product.Active {
+		app.notFound(w, r)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, app.newProductResponse(product))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+	"github.com/amirulabu/pokemon-store-backend/internal/search"
+	"github.com/amirulabu/pokemon-store-backend/internal/validator"
+)
+
+// catalogSearchIndex holds the search index over the catalog, rebuilt on
+// first use after the catalog has changed.
+type catalogSearchIndex struct {
+	mu      sync.Mutex
+	index   *search.Index
+	version string
+}
+
+func (app *application) catalogSearchIndex() (*search.Index, error) {
+	totals, err := app.db.GetCatalogTotals()
+	if err != nil {
+		return nil, err
+	}
+
+	version := fmt.Sprint(totals.Pokemon, totals.LastSyncedAt)
+
+	app.search.mu.Lock()
+	defer app.search.mu.Unlock()
+
+	if app.search.index != nil && app.search.version == version {
+		return app.search.index, nil
+	}
+
+	terms, err := app.db.ListCatalogSearchTerms()
+	if err != nil {
+		return nil, err
+	}
+
+	index := search.NewIndex()
+	for _, t := range terms {
+		index.Add(t.PokemonID, t.PokemonName, search.Field(t.Kind), t.Name)
+	}
+
+	app.search.index = index
+	app.search.version = version
+
+	return index, nil
+}
+
+func (app *application) searchPokemon(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	limit := getURLQueryParamInt(r, "limit", 10)
+
+	var v validator.Validator
+
+	v.CheckField(validator.NotBlank(q), "q", "Must be provided")
+	v.CheckField(validator.MaxRunes(q, 100), "q", "Must not be more than 100 characters")
+	v.CheckField(validator.Between(limit, 1, 50), "limit", "Must be between 1 and 50")
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	index, err := app.catalogSearchIndex()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	type result struct {
+		ID           int
+		Name         string
+		URL          string
+		Score        float64
+		MatchedField search.Field
+		Matched      string
+	}
+
+	matches := index.Search(q, limit)
+	results := make([]result, len(matches))
+
+	for i, match := range matches {
+		results[i] = result{
+			ID:           match.ID,
+			Name:         match.Name,
+			URL:          app.pokemon.StoreURL(fmt.Sprintf("/pokemon/%d", match.ID)),
+			Score:        math.Round(match.Score*1000) / 1000,
+			MatchedField: match.Field,
+			Matched:      match.Matched,
+		}
+	}
+
+	data := map[string]any{
+		"Query":   q,
+		"Results": results,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+)
+
+// getSpeciesOf returns the species of p, revalidating it in the background
+// when it was served stale.
+func (app *application) getSpeciesOf(r *http.Request, p pokemon.SinglePokemon) (pokemon.Species, cached_http.Info, error) {
+	species, cacheInfo, err := app.pokemon.GetSpeciesOf(p)
+	if err != nil {
+		return pokemon.Species{}, cached_http.Info{}, err
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	return species, cacheInfo, nil
+}
+
+// getEvolutionChainOf returns the evolution chain of species, revalidating it
+// in the background when it was served stale.
+func (app *application) getEvolutionChainOf(r *http.Request, species pokemon.Species) (pokemon.EvolutionChain, cached_http.Info, error) {
+	chain, cacheInfo, err := app.pokemon.GetEvolutionChainOf(species)
+	if err != nil {
+		return pokemon.EvolutionChain{}, cached_http.Info{}, err
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	return chain, cacheInfo, nil
+}
+
+// getPokemonSpecies looks the species up through the Pokémon rather than by
+// name, as alternate forms such as charizard-mega-x are named differently
+// from their species.
+func (app *application) getPokemonSpecies(w http.ResponseWriter, r *http.Request) {
+	p, cacheInfo, err := app.pokemon.GetSinglePokemon(flow.Param(r.Context(), "nameOrId"))
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	species, speciesInfo, err := app.getSpeciesOf(r, p)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	headers := cacheHeaders(cached_http.MergeInfo(cacheInfo, speciesInfo).Status)
+
+	err = response.JSONWithHeaders(w, http.StatusOK, app.pokemon.NewSpeciesV1(species), headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getPokemonEvolutions(w http.ResponseWriter, r *http.Request) {
+	p, cacheInfo, err := app.pokemon.GetSinglePokemon(flow.Param(r.Context(), "nameOrId"))
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	species, speciesInfo, err := app.getSpeciesOf(r, p)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	chain, chainInfo, err := app.getEvolutionChainOf(r, species)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"ChainID":    chain.ID,
+		"Species":    species.Name,
+		"Evolutions": app.pokemon.NewEvolutionsV1(chain),
+	}
+
+	headers := cacheHeaders(cached_http.MergeInfo(cacheInfo, speciesInfo, chainInfo).Status)
+
+	err = response.JSONWithHeaders(w, http.StatusOK, data, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
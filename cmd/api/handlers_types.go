@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alexedwards/flow"
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
+	"github.com/amirulabu/pokemon-store-backend/internal/response"
+)
+
+// getTypeChart returns every type and the damage chart between them, after
+// scheduling background revalidation of any that were served stale.
+func (app *application) getTypeChart(r *http.Request) ([]pokemon.Type, pokemon.TypeChart, cached_http.Info, error) {
+	types, cacheInfo, err := app.pokemon.GetTypes()
+	if err != nil {
+		return nil, nil, cached_http.Info{}, err
+	}
+
+	if cacheInfo.Revalidate != nil {
+		app.backgroundTask(r, cacheInfo.Revalidate)
+	}
+
+	return types, pokemon.NewTypeChart(types), cacheInfo, nil
+}
+
+func (app *application) getTypes(w http.ResponseWriter, r *http.Request) {
+	types, chart, cacheInfo, err := app.getTypeChart(r)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	headers := cacheHeaders(cacheInfo.Status)
+
+	results := make([]pokemon.TypeV1, len(types))
+	for i, t := range types {
+		results[i] = app.pokemon.NewTypeV1(t)
+	}
+
+	data := map[string]any{
+		"Types": results,
+		"Chart": chart,
+	}
+
+	err = response.JSONWithHeaders(w, http.StatusOK, data, headers)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getType(w http.ResponseWriter, r *http.Request) {
+	name := flow.Param(r.Context(), "name")
+
+	types, chart, cacheInfo, err := app.getTypeChart(r)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	headers := cacheHeaders(cacheInfo.Status)
+
+	for _, t := range types {
+		if t.Name == name || strconv.Itoa(t.ID) == name {
+			err = response.JSONWithHeaders(w, http.StatusOK, app.pokemon.NewTypeDetailV1(t, chart), headers)
+			if err != nil {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+	}
+
+	app.notFound(w, r)
+}
+
+// getPokemonMatchup compares two Pokémon by type only: how hard each of the
+// attacker's types hits the defender, how hard the defender's types hit back,
+// and the full defensive profile of both.
+func (app *application) getPokemonMatchup(w http.ResponseWriter, r *http.Request) {
+	type participant struct {
+		Name    string
+		URL     string
+		Types   []string
+		Defense map[string]float64
+	}
+
+	_, chart, chartInfo, err := app.getTypeChart(r)
+	if err != nil {
+		app.upstreamError(w, r, err)
+		return
+	}
+
+	infos := []cached_http.Info{chartInfo}
+
+	var participants [2]participant
+
+	for i, param := range []string{"a", "b"} {
+		p, cacheInfo, err := app.pokemon.GetSinglePokemon(flow.Param(r.Context(), param))
+		if err != nil {
+			app.upstreamError(w, r, err)
+			return
+		}
+
+		if cacheInfo.Revalidate != nil {
+			app.backgroundTask(r, cacheInfo.Revalidate)
+		}
+
+		infos = append(infos, cacheInfo)
+
+		types := pokemon.NewPokemonV1(p).Types
+
+		participants[i] = participant{
+			Name:    p.Name,
+			URL:     app.pokemon.StoreURL(fmt.Sprintf("/pokemon/%d", p.ID)),
+			Types:   types,
+			Defense: chart.Defense(types),
+		}
+	}
+
+	attacker, defender := participants[0], participants[1]
+
+	attack := make(map[string]float64, len(attacker.Types))
+	bestAttack := 0.0
+	for _, t := range attacker.Types {
+		attack[t] = chart.Multiplier(t, defender.Types)
+		if attack[t] > bestAttack {
+			bestAttack = attack[t]
+		}
+	}
+
+	counterAttack := make(map[string]float64, len(defender.Types))
+	bestCounterAttack := 0.0
+	for _, t := range defender.Types {
+		counterAttack[t] = chart.Multiplier(t, attacker.Types)
+		if counterAttack[t] > bestCounterAttack {
+			bestCounterAttack = counterAttack[t]
+		}
+	}
+
+	advantage := "neutral"
+	switch {
+	case bestAttack > bestCounterAttack:
+		advantage = "attacker"
+	case bestAttack < bestCounterAttack:
+		advantage = "defender"
+	}
+
+	data := map[string]any{
+		"Attacker":      attacker,
+		"Defender":      defender,
+		"Attack":        attack,
+		"CounterAttack": counterAttack,
+		"Advantage":     advantage,
+	}
+
+	err = response.JSONWithHeaders(w, http.StatusOK, data, cacheHeaders(cached_http.MergeInfo(infos...).Status))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
 )
 
 func (app *application) newEmailData() map[string]any {
@@ -13,6 +15,23 @@ func (app *application) newEmailData() map[string]any {
 	return data
 }
 
+// cacheHeaders reports how upstream data was served in an X-Cache header, and
+// flags stale data (served during background revalidation, after a failed
+// refetch or while the upstream circuit breaker is open) with a Warning.
+func cacheHeaders(status cached_http.Status) http.Header {
+	headers := make(http.Header)
+
+	if status != "" {
+		headers.Set("X-Cache", string(status))
+	}
+
+	if status == cached_http.StatusStale {
+		headers.Set("Warning", `110 - "Response is Stale"`)
+	}
+
+	return headers
+}
+
 func (app *application) backgroundTask(r *http.Request, fn func() error) {
 	app.wg.Add(1)
 
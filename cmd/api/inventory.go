@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// sweepReservations deletes expired stock reservations every interval until
+// ctx is done. Expired reservations stop holding stock back as soon as they
+// expire, sweeping them only keeps the table small.
+func (app *application) sweepReservations(ctx context.Context, interval time.Duration) {
+	defer app.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := app.db.DeleteExpiredReservations()
+			if err != nil {
+				app.logger.Error(err.Error())
+				continue
+			}
+
+			if deleted > 0 {
+				app.logger.Info("swept expired reservations", "deleted", deleted)
+			}
+		}
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"runtime/debug"
 	"sync"
+	"time"
 
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
 	"github.com/amirulabu/pokemon-store-backend/internal/database"
 	"github.com/amirulabu/pokemon-store-backend/internal/env"
+	"github.com/amirulabu/pokemon-store-backend/internal/fakepokeapi"
+	"github.com/amirulabu/pokemon-store-backend/internal/payments"
+	"github.com/amirulabu/pokemon-store-backend/internal/pokemon"
 	"github.com/amirulabu/pokemon-store-backend/internal/smtp"
+	"github.com/amirulabu/pokemon-store-backend/internal/upstream"
 	"github.com/amirulabu/pokemon-store-backend/internal/version"
 
 	"github.com/lmittmann/tint"
@@ -35,6 +42,14 @@ type config struct {
 		username       string
 		hashedPassword string
 	}
+	cache struct {
+		defaultTTL           time.Duration
+		ttlRules             string
+		notFoundTTL          time.Duration
+		staleWhileRevalidate time.Duration
+		memoryMaxEntries     int
+		memoryMaxBytes       int
+	}
 	cookie struct {
 		secretKey string
 	}
@@ -42,12 +57,31 @@ type config struct {
 		dsn         string
 		automigrate bool
 	}
+	inventory struct {
+		reservationTTL time.Duration
+		sweepInterval  time.Duration
+	}
 	jwt struct {
 		secretKey string
 	}
 	notifications struct {
 		email string
 	}
+	payments struct {
+		provider            string
+		webhookSecret       string
+		refundRetryInterval time.Duration
+	}
+	pokeAPI struct {
+		baseURL          string
+		timeout          time.Duration
+		userAgent        string
+		maxRetries       int
+		retryBaseDelay   time.Duration
+		retryMaxDelay    time.Duration
+		breakerThreshold int
+		breakerCooldown  time.Duration
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -55,14 +89,22 @@ type config struct {
 		password string
 		from     string
 	}
+	store struct {
+		currency string
+	}
 }
 
 type application struct {
-	config config
-	db     *database.DB
-	logger *slog.Logger
-	mailer *smtp.Mailer
-	wg     sync.WaitGroup
+	config   config
+	cache    *cached_http.Cache
+	db       *database.DB
+	logger   *slog.Logger
+	mailer   *smtp.Mailer
+	payments payments.Provider
+	pokemon  *pokemon.Client
+	search   catalogSearchIndex
+	upstream *upstream.Client
+	wg       sync.WaitGroup
 }
 
 func run(logger *slog.Logger) error {
@@ -73,18 +115,39 @@ func run(logger *slog.Logger) error {
 	cfg.httpPort = env.GetInt("HTTP_PORT", 4444)
 	cfg.basicAuth.username = env.GetString("BASIC_AUTH_USERNAME", "admin")
 	cfg.basicAuth.hashedPassword = env.GetString("BASIC_AUTH_HASHED_PASSWORD", "$2a$10$jRb2qniNcoCyQM23T59RfeEQUbgdAXfR6S0scynmKfJa5Gj3arGJa")
+	cfg.cache.defaultTTL = env.GetDuration("CACHE_DEFAULT_TTL", 7*24*time.Hour)
+	cfg.cache.ttlRules = env.GetString("CACHE_TTL_RULES", `/pokemon\?=24h`)
+	cfg.cache.notFoundTTL = env.GetDuration("CACHE_NOT_FOUND_TTL", 10*time.Minute)
+	cfg.cache.staleWhileRevalidate = env.GetDuration("CACHE_STALE_WHILE_REVALIDATE", 24*time.Hour)
+	cfg.cache.memoryMaxEntries = env.GetInt("CACHE_MEMORY_MAX_ENTRIES", 1000)
+	cfg.cache.memoryMaxBytes = env.GetInt("CACHE_MEMORY_MAX_BYTES", 64*1024*1024)
 	cfg.cookie.secretKey = env.GetString("COOKIE_SECRET_KEY", "5lw5v5uh2qrceem3ukl7sbqw4y5iicuz")
 	cfg.db.dsn = env.GetString("DB_DSN", "db.sqlite")
 	cfg.db.automigrate = env.GetBool("DB_AUTOMIGRATE", true)
+	cfg.inventory.reservationTTL = env.GetDuration("INVENTORY_RESERVATION_TTL", 15*time.Minute)
+	cfg.inventory.sweepInterval = env.GetDuration("INVENTORY_SWEEP_INTERVAL", time.Minute)
 	cfg.jwt.secretKey = env.GetString("JWT_SECRET_KEY", "nouvrbre6d5ontercyizqkkvt4wipbi5")
 	cfg.notifications.email = env.GetString("NOTIFICATIONS_EMAIL", "")
+	cfg.payments.provider = env.GetString("PAYMENTS_PROVIDER", "")
+	cfg.payments.webhookSecret = env.GetString("PAYMENTS_WEBHOOK_SECRET", "")
+	cfg.payments.refundRetryInterval = env.GetDuration("PAYMENTS_REFUND_RETRY_INTERVAL", 5*time.Minute)
+	cfg.pokeAPI.baseURL = env.GetString("POKEAPI_BASE_URL", "https://pokeapi.co/api/v2")
+	cfg.pokeAPI.timeout = env.GetDuration("POKEAPI_TIMEOUT", 10*time.Second)
+	cfg.pokeAPI.userAgent = env.GetString("POKEAPI_USER_AGENT", "pokemon-store-backend/"+version.Get())
+	cfg.pokeAPI.maxRetries = env.GetInt("POKEAPI_MAX_RETRIES", 2)
+	cfg.pokeAPI.retryBaseDelay = env.GetDuration("POKEAPI_RETRY_BASE_DELAY", 200*time.Millisecond)
+	cfg.pokeAPI.retryMaxDelay = env.GetDuration("POKEAPI_RETRY_MAX_DELAY", 2*time.Second)
+	cfg.pokeAPI.breakerThreshold = env.GetInt("POKEAPI_BREAKER_THRESHOLD", 5)
+	cfg.pokeAPI.breakerCooldown = env.GetDuration("POKEAPI_BREAKER_COOLDOWN", 30*time.Second)
 	cfg.smtp.host = env.GetString("SMTP_HOST", "example.smtp.host")
 	cfg.smtp.port = env.GetInt("SMTP_PORT", 25)
 	cfg.smtp.username = env.GetString("SMTP_USERNAME", "example_username")
 	cfg.smtp.password = env.GetString("SMTP_PASSWORD", "pa55word")
 	cfg.smtp.from = env.GetString("SMTP_FROM", "Example Name <no_reply@example.org>")
+	cfg.store.currency = env.GetString("STORE_CURRENCY", "USD")
 
 	showVersion := flag.Bool("version", false, "display version and exit")
+	fakeUpstream := flag.Bool("fake-upstream", false, "serve PokeAPI requests from embedded fixtures instead of POKEAPI_BASE_URL")
 
 	flag.Parse()
 
@@ -93,20 +156,137 @@ func run(logger *slog.Logger) error {
 		return nil
 	}
 
+	if cfg.inventory.reservationTTL <= 0 {
+		return fmt.Errorf("INVENTORY_RESERVATION_TTL must be positive, got %s", cfg.inventory.reservationTTL)
+	}
+
+	if cfg.inventory.sweepInterval <= 0 {
+		return fmt.Errorf("INVENTORY_SWEEP_INTERVAL must be positive, got %s", cfg.inventory.sweepInterval)
+	}
+
+	if cfg.payments.refundRetryInterval <= 0 {
+		return fmt.Errorf("PAYMENTS_REFUND_RETRY_INTERVAL must be positive, got %s", cfg.payments.refundRetryInterval)
+	}
+
+	// Development gets the simulator and a webhook secret of its own, so that
+	// payments work out of the box. Elsewhere payments are off unless a
+	// provider is configured
+	if cfg.env == "development" {
+		if cfg.payments.provider == "" {
+			cfg.payments.provider = "simulator"
+		}
+
+		if cfg.payments.webhookSecret == "" {
+			cfg.payments.webhookSecret = "development-webhook-secret"
+		}
+	}
+
+	if cfg.payments.provider == "" {
+		cfg.payments.provider = "none"
+	}
+
+	command := flag.Arg(0)
+
+	// Only the server and the payment-webhook command verify or sign webhooks
+	needsWebhookSecret := command == "" || command == "payment-webhook"
+
+	if needsWebhookSecret && cfg.payments.provider != "none" && cfg.payments.webhookSecret == "" {
+		return errors.New("PAYMENTS_WEBHOOK_SECRET must be set")
+	}
+
+	if *fakeUpstream {
+		fakeServer := fakepokeapi.NewServer()
+		defer fakeServer.Close()
+
+		cfg.pokeAPI.baseURL = fakeServer.BaseURL()
+		logger.Info("using fake upstream", slog.Group("upstream", "url", cfg.pokeAPI.baseURL))
+	}
+
 	db, err := database.New(cfg.db.dsn, cfg.db.automigrate)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	ttlRules, err := cached_http.ParseTTLRules(cfg.cache.ttlRules)
+	if err != nil {
+		return err
+	}
+
+	upstreamClient := upstream.New(upstream.Options{
+		BaseURL:          cfg.pokeAPI.baseURL,
+		UserAgent:        cfg.pokeAPI.userAgent,
+		Timeout:          cfg.pokeAPI.timeout,
+		MaxRetries:       cfg.pokeAPI.maxRetries,
+		RetryBaseDelay:   cfg.pokeAPI.retryBaseDelay,
+		RetryMaxDelay:    cfg.pokeAPI.retryMaxDelay,
+		BreakerThreshold: cfg.pokeAPI.breakerThreshold,
+		BreakerCooldown:  cfg.pokeAPI.breakerCooldown,
+	})
+
+	cache := cached_http.New(db, cached_http.Options{
+		Client:               upstreamClient,
+		DefaultTTL:           cfg.cache.defaultTTL,
+		TTLRules:             ttlRules,
+		NotFoundTTL:          cfg.cache.notFoundTTL,
+		StaleWhileRevalidate: cfg.cache.staleWhileRevalidate,
+		MemoryMaxEntries:     cfg.cache.memoryMaxEntries,
+		MemoryMaxBytes:       int64(cfg.cache.memoryMaxBytes),
+		Logger:               logger,
+	})
+
 	mailer := smtp.NewMailer(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.from)
 
+	var paymentProvider payments.Provider
+
+	switch cfg.payments.provider {
+	case "none":
+		// Payments are off, and the payment routes are not served
+	case "simulator":
+		// The simulator takes payments without any money changing hands
+		if cfg.env != "development" {
+			return fmt.Errorf("the simulator payments provider can only be used when ENV is development, not %q", cfg.env)
+		}
+
+		simulator := payments.NewSimulator(cfg.payments.webhookSecret)
+
+		err = restoreSimulator(db, simulator)
+		if err != nil {
+			return err
+		}
+
+		paymentProvider = simulator
+	default:
+		return fmt.Errorf("unknown payments provider %q", cfg.payments.provider)
+	}
+
 	app := &application{
-		config: cfg,
-		db:     db,
-		logger: logger,
-		mailer: mailer,
+		config:   cfg,
+		cache:    cache,
+		db:       db,
+		logger:   logger,
+		mailer:   mailer,
+		payments: paymentProvider,
+		pokemon:  pokemon.NewClient(cache, upstreamClient.BaseURL(), cfg.baseURL),
+		upstream: upstreamClient,
 	}
 
-	return app.serveHTTP()
+	switch command {
+	case "":
+		return app.serveHTTP()
+	case "cache-warm":
+		return app.warmCache(flag.Args()[1:])
+	case "cache-compress":
+		return app.compressCache(flag.Args()[1:])
+	case "cache-export":
+		return app.exportCache(flag.Args()[1:])
+	case "cache-import":
+		return app.importCache(flag.Args()[1:])
+	case "catalog-sync":
+		return app.syncCatalog(flag.Args()[1:])
+	case "payment-webhook":
+		return app.sendPaymentWebhook(flag.Args()[1:])
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
 }
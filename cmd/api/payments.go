@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/payments"
+)
+
+// restoreSimulator puts the intents of the payments stored for the simulator
+// back into it, since it only keeps them in memory.
+func restoreSimulator(db *database.DB, simulator *payments.Simulator) error {
+	storedPayments, err := db.GetProviderPayments(simulator.Name())
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range storedPayments {
+		simulator.Restore(payments.Intent{
+			ID:        payment.IntentID,
+			Reference: orderPaymentReference(payment.OrderID),
+			Amount:    payment.Amount,
+			Currency:  payment.Currency,
+			Status:    payment.Status,
+		})
+	}
+
+	return nil
+}
+
+// sendPaymentWebhook posts a simulated webhook event for a payment intent to
+// the running application at BASE_URL, standing in for the payment provider
+// when the simulator is used.
+func (app *application) sendPaymentWebhook(args []string) error {
+	fs := flag.NewFlagSet("payment-webhook", flag.ContinueOnError)
+	eventType := fs.String("event", payments.EventAuthorized, "event type to send")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: payment-webhook [-event=payment.authorized] <intent-id>")
+	}
+
+	simulator, ok := app.payments.(*payments.Simulator)
+	if !ok {
+		return fmt.Errorf("payment-webhook needs the simulator provider, not %q", app.config.payments.provider)
+	}
+
+	payload, header, err := simulator.Webhook(*eventType, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, app.config.baseURL+"/payments/webhook", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header = header
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n%s\n", resp.Status, body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook was not accepted: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -41,14 +41,38 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("/status", app.status, "GET")
 	mux.HandleFunc("/users", app.createUser, "POST")
 	mux.HandleFunc("/authentication-tokens", app.createAuthenticationToken, "POST")
+	mux.HandleFunc("/pokemon/search", app.searchPokemon, "GET")
 	mux.HandleFunc("/pokemon/:nameOrId", app.getPokemonByNameOrId, "GET")
+	mux.HandleFunc("/pokemon/:nameOrId/species", app.getPokemonSpecies, "GET")
+	mux.HandleFunc("/pokemon/:nameOrId/evolutions", app.getPokemonEvolutions, "GET")
+	mux.HandleFunc("/pokemon/:a/matchup/:b", app.getPokemonMatchup, "GET")
+	mux.HandleFunc("/types", app.getTypes, "GET")
+	mux.HandleFunc("/types/:name", app.getType, "GET")
 	mux.HandleFunc("/pokemon", app.getPokemons, "GET")
+	mux.HandleFunc("/products", app.getProducts, "GET")
+	mux.HandleFunc("/products/:id|^[0-9]+$", app.getActiveProduct, "GET")
+	mux.HandleFunc("/cart", app.getCart, "GET")
+	mux.HandleFunc("/cart/items", app.addCartItem, "POST")
+	mux.HandleFunc("/cart/items/:id|^[0-9]+$", app.updateCartItem, "PATCH")
+	mux.HandleFunc("/cart/items/:id|^[0-9]+$", app.removeCartItem, "DELETE")
+	mux.HandleFunc("/cart/checkout", app.checkoutCart, "POST")
+
+	if app.payments != nil {
+		mux.HandleFunc("/payments/webhook", app.paymentWebhook, "POST")
+	}
 
 	mux.Group(func(mux *flow.Mux) {
 		mux.Use(app.requireAuthenticatedUser)
 
 		mux.HandleFunc("/protected", app.protected, "GET")
 		mux.HandleFunc("/change-password", app.changePassword, "POST")
+		mux.HandleFunc("/orders", app.getOrders, "GET")
+		mux.HandleFunc("/orders", app.createOrder, "POST")
+		mux.HandleFunc("/orders/:id|^[0-9]+$", app.getOrder, "GET")
+
+		if app.payments != nil {
+			mux.HandleFunc("/orders/:id|^[0-9]+$/payments", app.createPayment, "POST")
+		}
 
 		mux.Group(func(mux *flow.Mux) {
 			mux.Use(app.requireAdminUser)
@@ -56,6 +80,27 @@ func (app *application) routes() http.Handler {
 			mux.HandleFunc("/admin/protected", app.protected, "GET")
 			mux.HandleFunc("/admin/users", app.getAllUsers, "GET")
 			mux.HandleFunc("/admin/change-user-password", app.changePasswordById, "POST")
+			mux.HandleFunc("/admin/cache", app.purgeAllCachedResponses, "DELETE")
+			mux.HandleFunc("/admin/cache/stats", app.getCacheStats, "GET")
+			mux.HandleFunc("/admin/cache/memory", app.getCacheMemoryStats, "GET")
+			mux.HandleFunc("/admin/cache/entries", app.listCachedResponses, "GET")
+			mux.HandleFunc("/admin/cache/entries", app.purgeCachedResponses, "DELETE")
+			mux.HandleFunc("/admin/cache/entries/:id|^[0-9]+$", app.getCachedResponsePayload, "GET")
+			mux.HandleFunc("/admin/upstream", app.getUpstreamStatus, "GET")
+			mux.HandleFunc("/admin/catalog", app.getCatalogStats, "GET")
+			mux.HandleFunc("/admin/products", app.getAllProducts, "GET")
+			mux.HandleFunc("/admin/products", app.createProduct, "POST")
+			mux.HandleFunc("/admin/products/:id|^[0-9]+$", app.getProductByID, "GET")
+			mux.HandleFunc("/admin/products/:id|^[0-9]+$", app.updateProduct, "PATCH")
+			mux.HandleFunc("/admin/products/:id|^[0-9]+$", app.deleteProduct, "DELETE")
+			mux.HandleFunc("/admin/inventory", app.listInventory, "GET")
+			mux.HandleFunc("/admin/inventory-adjustments", app.listInventoryAdjustments, "GET")
+			mux.HandleFunc("/admin/inventory/:sku", app.getInventory, "GET")
+			mux.HandleFunc("/admin/inventory/:sku/adjustments", app.listInventoryAdjustments, "GET")
+			mux.HandleFunc("/admin/inventory/:sku/adjustments", app.adjustInventory, "POST")
+			mux.HandleFunc("/admin/orders", app.getAllOrders, "GET")
+			mux.HandleFunc("/admin/orders/:id|^[0-9]+$", app.getOrderByID, "GET")
+			mux.HandleFunc("/admin/orders/:id|^[0-9]+$/transitions", app.transitionOrder, "POST")
 		})
 	})
 
@@ -43,6 +43,17 @@ func (app *application) serveHTTP() error {
 		shutdownErrorChan <- srv.Shutdown(ctx)
 	}()
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	app.wg.Add(1)
+	go app.sweepReservations(backgroundCtx, app.config.inventory.sweepInterval)
+
+	if app.payments != nil {
+		app.wg.Add(1)
+		go app.retryRefunds(backgroundCtx, app.config.payments.refundRetryInterval)
+	}
+
 	app.logger.Info("starting server", slog.Group("server", "addr", srv.Addr))
 
 	err := srv.ListenAndServe()
@@ -57,6 +68,8 @@ func (app *application) serveHTTP() error {
 
 	app.logger.Info("stopped server", slog.Group("server", "addr", srv.Addr))
 
+	stopBackground()
+
 	app.wg.Wait()
 	return nil
 }
@@ -3,6 +3,8 @@ module github.com/amirulabu/pokemon-store-backend
 go 1.19
 
 require (
+	github.com/MadAppGang/httplog v1.3.0
+	github.com/MadAppGang/httplog/zap v1.2.1
 	github.com/alexedwards/flow v0.0.0-20220806114457-cf11be9e0e03
 	github.com/go-mail/mail/v2 v2.3.0
 	github.com/golang-migrate/migrate/v4 v4.16.2
@@ -10,14 +12,14 @@ require (
 	github.com/lmittmann/tint v0.3.4
 	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/pascaldekloe/jwt v1.12.0
+	go.uber.org/zap v1.25.0
 	golang.org/x/crypto v0.11.0
 	golang.org/x/exp v0.0.0-20230711153332-06a737ee72cb
+	golang.org/x/sync v0.3.0
 	golang.org/x/text v0.11.0
 )
 
 require (
-	github.com/MadAppGang/httplog v1.3.0 // indirect
-	github.com/MadAppGang/httplog/zap v1.2.1 // indirect
 	github.com/TylerBrock/colorjson v0.0.0-20200706003622-8a50f05110d2 // indirect
 	github.com/fatih/color v1.13.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
@@ -26,7 +28,6 @@ require (
 	github.com/mattn/go-isatty v0.0.17 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.25.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
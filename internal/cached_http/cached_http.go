@@ -1,46 +1,525 @@
 package cached_http
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/lru"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/singleflight"
 )
 
 var cacheMutex sync.Mutex
 
-func CacheAndRetrieve(url string, db *database.DB) ([]byte, error) {
+// TTLRule sets how long cached responses for URLs matching Pattern stay fresh.
+type TTLRule struct {
+	Pattern *regexp.Regexp
+	TTL     time.Duration
+}
+
+// ParseTTLRules parses a comma separated list of pattern=duration pairs, for
+// example `/pokemon\?=24h,/pokemon/=168h`. Patterns are regular expressions
+// matched against the full upstream URL.
+func ParseTTLRules(s string) ([]TTLRule, error) {
+	var rules []TTLRule
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid TTL rule %q: expected pattern=duration", pair)
+		}
+
+		pattern, err := regexp.Compile(pair[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid TTL rule %q: %w", pair, err)
+		}
+
+		ttl, err := time.ParseDuration(pair[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid TTL rule %q: %w", pair, err)
+		}
+
+		rules = append(rules, TTLRule{Pattern: pattern, TTL: ttl})
+	}
+
+	return rules, nil
+}
+
+// HTTPClient is the subset of *http.Client used to reach the upstream, so that
+// callers can inject their own transport, timeouts and headers.
+type HTTPClient interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+type Options struct {
+	// Client sends upstream requests. http.DefaultClient is used when nil.
+	Client HTTPClient
+
+	DefaultTTL time.Duration
+	TTLRules   []TTLRule
+
+	// How long an upstream 404 is remembered before the URL is tried again.
+	NotFoundTTL time.Duration
+
+	// For this long after expiry a response is still served straight from the
+	// cache, with the caller expected to refresh it in the background. Zero
+	// disables stale-while-revalidate.
+	StaleWhileRevalidate time.Duration
+
+	// Limits for the in-memory tier of decoded responses. Zero means unbounded.
+	MemoryMaxEntries int
+	MemoryMaxBytes   int64
+
+	// Logger receives a debug entry for every lookup. Nothing is logged when
+	// nil.
+	Logger *slog.Logger
+}
+
+type Cache struct {
+	db                   *database.DB
+	client               HTTPClient
+	defaultTTL           time.Duration
+	rules                []TTLRule
+	notFoundTTL          time.Duration
+	staleWhileRevalidate time.Duration
+	group                singleflight.Group
+	memory               *lru.Cache[string, any]
+	logger               *slog.Logger
+
+	// generation counts invalidations, so that values retrieved before one
+	// are not put in the memory tier after it
+	generation atomic.Uint64
+}
+
+func New(db *database.DB, opts Options) *Cache {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Cache{
+		db:                   db,
+		client:               client,
+		defaultTTL:           opts.DefaultTTL,
+		rules:                opts.TTLRules,
+		notFoundTTL:          opts.NotFoundTTL,
+		staleWhileRevalidate: opts.StaleWhileRevalidate,
+		memory:               lru.New[string, any](opts.MemoryMaxEntries, opts.MemoryMaxBytes),
+		logger:               opts.Logger,
+	}
+}
+
+func (c *Cache) debug(msg, url string) {
+	if c.logger != nil {
+		c.logger.Debug(msg, "url", url)
+	}
+}
+
+// TTL returns the freshness lifetime for url. The first matching rule wins and
+// the default TTL applies when no rule matches.
+func (c *Cache) TTL(url string) time.Duration {
+	for _, rule := range c.rules {
+		if rule.Pattern.MatchString(url) {
+			return rule.TTL
+		}
+	}
+
+	return c.defaultTTL
+}
+
+func (c *Cache) ttlFor(url string, statusCode int) time.Duration {
+	if statusCode == http.StatusNotFound {
+		return c.notFoundTTL
+	}
+
+	return c.TTL(url)
+}
+
+// Fresh reports whether url has an unexpired entry in the SQLite tier, without
+// contacting upstream.
+func (c *Cache) Fresh(url string) (bool, error) {
+	cachedResponse, err := c.db.GetCachedResponse(url)
+	if err != nil || cachedResponse == nil {
+		return false, err
+	}
+
+	return time.Since(cachedResponse.FetchedAt) < c.ttlFor(url, cachedResponse.StatusCode), nil
+}
+
+// MemoryStats reports the hit, miss and occupancy counters of the in-memory
+// tier.
+func (c *Cache) MemoryStats() lru.Stats {
+	return c.memory.Stats()
+}
+
+// Invalidate drops url from both the in-memory and SQLite tiers and reports
+// how many cached rows were removed.
+func (c *Cache) Invalidate(url string) (int, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	n, err := c.db.DeleteCachedResponse(url)
+	c.generation.Add(1)
+	c.memory.Remove(url)
+
+	return n, err
+}
+
+// InvalidatePrefix drops every URL starting with prefix from both tiers.
+func (c *Cache) InvalidatePrefix(prefix string) (int, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	n, err := c.db.DeleteCachedResponsesByPrefix(prefix)
+	c.generation.Add(1)
+	c.memory.RemoveFunc(func(url string) bool { return strings.HasPrefix(url, prefix) })
+
+	return n, err
+}
+
+// InvalidateAll empties both tiers.
+func (c *Cache) InvalidateAll() (int, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	n, err := c.db.DeleteAllCachedResponses()
+	c.generation.Add(1)
+	c.memory.RemoveFunc(func(string) bool { return true })
+
+	return n, err
+}
+
+// Status reports where a retrieved response came from.
+type Status string
+
+const (
+	// StatusHit is a fresh response served from the memory or SQLite tier.
+	StatusHit Status = "HIT"
+	// StatusMiss is a response that had to be fetched from upstream.
+	StatusMiss Status = "MISS"
+	// StatusStale is an expired response, served either because upstream
+	// failed or while it is being revalidated in the background.
+	StatusStale Status = "STALE"
+)
+
+// Info describes how a retrieved response was served.
+type Info struct {
+	Status Status
+
+	// Revalidate refreshes a response served under stale-while-revalidate. It
+	// is nil otherwise, and is meant to be run in the background.
+	Revalidate func() error
+}
+
+// MergeInfo combines the cache information of several resources used in one
+// response, reporting the stalest status and revalidating all of them.
+func MergeInfo(infos ...Info) Info {
+	merged := Info{Status: StatusHit}
+
+	var revalidates []func() error
+
+	for _, info := range infos {
+		switch {
+		case info.Status == StatusStale:
+			merged.Status = StatusStale
+		case info.Status == StatusMiss && merged.Status == StatusHit:
+			merged.Status = StatusMiss
+		}
+
+		if info.Revalidate != nil {
+			revalidates = append(revalidates, info.Revalidate)
+		}
+	}
+
+	if len(revalidates) > 0 {
+		merged.Revalidate = func() error {
+			var firstErr error
+			for _, revalidate := range revalidates {
+				err := revalidate()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+			return firstErr
+		}
+	}
+
+	return merged
+}
+
+// CacheAndRetrieve returns the payload for url, fetching it from upstream when
+// it is missing or expired. Concurrent calls for the same url share a single
+// lookup, upstream fetch and cache write.
+func (c *Cache) CacheAndRetrieve(url string) ([]byte, error) {
+	e, err := c.retrieveShared(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.statusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	return e.payload, nil
+}
+
+// RetrieveJSON returns the response for url decoded into a T, along with where
+// it came from. Decoded values are kept in the in-memory tier until the
+// underlying payload expires, so callers must treat the returned value as
+// read-only.
+func RetrieveJSON[T any](c *Cache, url string) (T, Info, error) {
+	if value, ok := c.memory.Get(url); ok {
+		if data, ok := value.(T); ok {
+			return data, Info{Status: StatusHit}, nil
+		}
+	}
+
+	var zero T
+
+	type decoded struct {
+		data T
+		info Info
+	}
+
+	value, err, _ := c.group.Do(fmt.Sprintf("%T %s", zero, url), func() (any, error) {
+		e, err := c.retrieveShared(url)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.statusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+
+		var data T
+		err = json.Unmarshal(e.payload, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		// Stale payloads served after a failed refetch are not worth keeping
+		// Nor are payloads that were invalidated while they were decoded
+		expiresAt := e.fetchedAt.Add(c.ttlFor(url, e.statusCode))
+		if time.Now().Before(expiresAt) {
+			c.memory.AddIf(url, data, int64(len(e.payload)), expiresAt, func() bool {
+				return c.generation.Load() == e.generation
+			})
+		}
+
+		info := Info{Status: e.status}
+		if e.revalidate {
+			info.Revalidate = func() error { return c.refresh(url) }
+		}
+
+		return decoded{data: data, info: info}, nil
+	})
+	if err != nil {
+		return zero, Info{}, err
+	}
+
+	result := value.(decoded)
+	return result.data, result.info, nil
+}
+
+type entry struct {
+	statusCode int
+	payload    []byte
+	fetchedAt  time.Time
+	status     Status
+	revalidate bool
+
+	// generation is the cache's generation before the entry was read or
+	// fetched
+	generation uint64
+}
+
+func (c *Cache) retrieveShared(url string) (*entry, error) {
+	e, err, _ := c.group.Do(url, func() (any, error) {
+		return c.retrieve(url)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return e.(*entry), nil
+}
+
+func (c *Cache) retrieve(url string) (*entry, error) {
+	generation := c.generation.Load()
+
+	e, err := c.lookup(url)
+	if err != nil {
+		return nil, err
+	}
+
+	e.generation = generation
+	return e, nil
+}
+
+// lookup returns the cached response for url, fetching it from upstream when
+// it is missing or expired.
+func (c *Cache) lookup(url string) (*entry, error) {
 	// Check if the response is already cached
-	cachedResponse, err := db.GetCachedResponse(url)
-	if err == nil {
-		fmt.Println("Data retrieved from cache.")
-		return cachedResponse.Payload, nil
+	cachedResponse, err := c.db.GetCachedResponse(url)
+	if err != nil {
+		return nil, err
 	}
 
-	// Fetch data from the API
-	response, err := http.Get(url)
+	if cachedResponse != nil {
+		age := time.Since(cachedResponse.FetchedAt)
+		ttl := c.ttlFor(url, cachedResponse.StatusCode)
+
+		if age < ttl {
+			c.debug("cache hit", url)
+			return cachedEntry(cachedResponse, StatusHit), nil
+		}
+
+		if cachedResponse.StatusCode == http.StatusOK && age < ttl+c.staleWhileRevalidate {
+			c.debug("stale cache hit, revalidating", url)
+			e := cachedEntry(cachedResponse, StatusStale)
+			e.revalidate = true
+			return e, nil
+		}
+	}
+
+	e, err := c.update(url, cachedResponse)
 	if err != nil {
+		// Keep serving the expired payload rather than failing outright
+		if cachedResponse != nil {
+			c.debug("refetch failed, serving stale cache entry", url)
+			return cachedEntry(cachedResponse, StatusStale), nil
+		}
+
 		return nil, err
 	}
-	defer response.Body.Close()
 
-	// Read the response payload
-	payload, err := io.ReadAll(response.Body)
+	return e, nil
+}
+
+// refresh unconditionally revalidates url against upstream. Concurrent
+// refreshes of the same url are coalesced.
+func (c *Cache) refresh(url string) error {
+	_, err, _ := c.group.Do("refresh "+url, func() (any, error) {
+		cachedResponse, err := c.db.GetCachedResponse(url)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.update(url, cachedResponse)
+	})
+
+	return err
+}
+
+// update fetches url from upstream, revalidating cachedResponse when given, and
+// writes the outcome to the SQLite tier.
+func (c *Cache) update(url string, cachedResponse *database.CachedResponse) (*entry, error) {
+	// Fetch data from the API, revalidating any cached copy
+	result, err := c.fetch(url, cachedResponse)
 	if err != nil {
 		return nil, err
 	}
 
-	// Insert the response into the cache
+	// Insert or refresh the response in the cache
 	cacheMutex.Lock()
-	_, err = db.InsertCachedResponse(url, payload)
+	switch {
+	case result.notModified:
+		err = c.db.TouchCachedResponse(cachedResponse.ID)
+	default:
+		err = c.db.UpsertCachedResponse(url, result.statusCode, result.payload, result.etag, result.lastModified)
+	}
 	cacheMutex.Unlock()
 
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Data cached and retrieved successfully.")
-	return payload, nil
+	// Any decoded copy predates this write
+	c.memory.Remove(url)
+
+	if result.notModified {
+		c.debug("cache entry revalidated", url)
+		return &entry{statusCode: cachedResponse.StatusCode, payload: cachedResponse.Payload, fetchedAt: time.Now(), status: StatusHit}, nil
+	}
+
+	c.debug("cache miss, stored upstream response", url)
+	return &entry{statusCode: result.statusCode, payload: result.payload, fetchedAt: time.Now(), status: StatusMiss}, nil
+}
+
+func cachedEntry(cachedResponse *database.CachedResponse, status Status) *entry {
+	return &entry{
+		statusCode: cachedResponse.StatusCode,
+		payload:    cachedResponse.Payload,
+		fetchedAt:  cachedResponse.FetchedAt,
+		status:     status,
+	}
+}
+
+type fetchResult struct {
+	statusCode   int
+	payload      []byte
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// fetch performs a GET against url. When a cached copy is given its validators
+// are sent so that an unchanged resource comes back as a bodyless 304. Only
+// successful and 404 responses are returned as cacheable results, anything else
+// is reported as an *UpstreamError.
+func (c *Cache) fetch(url string, cachedResponse *database.CachedResponse) (*fetchResult, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachedResponse != nil {
+		if cachedResponse.ETag != "" {
+			request.Header.Set("If-None-Match", cachedResponse.ETag)
+		}
+		if cachedResponse.LastModified != "" {
+			request.Header.Set("If-Modified-Since", cachedResponse.LastModified)
+		}
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, &UpstreamError{URL: url, Err: err}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cachedResponse != nil:
+		return &fetchResult{notModified: true}, nil
+	case response.StatusCode == http.StatusNotFound:
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return nil, &UpstreamError{URL: url, StatusCode: response.StatusCode}
+	}
+
+	// Read the response payload
+	payload, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, &UpstreamError{URL: url, Err: err}
+	}
+
+	return &fetchResult{
+		statusCode:   response.StatusCode,
+		payload:      payload,
+		etag:         response.Header.Get("ETag"),
+		lastModified: response.Header.Get("Last-Modified"),
+	}, nil
 }
@@ -0,0 +1,166 @@
+package cached_http_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+	"github.com/amirulabu/pokemon-store-backend/internal/database"
+	"github.com/amirulabu/pokemon-store-backend/internal/fakepokeapi"
+)
+
+// recordingClient sends requests with http.DefaultClient and records what
+// the upstream was asked and how it answered.
+type recordingClient struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	statuses []int
+}
+
+func (c *recordingClient) Do(request *http.Request) (*http.Response, error) {
+	response, err := http.DefaultClient.Do(request)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests = append(c.requests, request)
+	if err == nil {
+		c.statuses = append(c.statuses, response.StatusCode)
+	}
+
+	return response, err
+}
+
+func (c *recordingClient) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.requests)
+}
+
+func (c *recordingClient) last() (*http.Request, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.requests[len(c.requests)-1], c.statuses[len(c.statuses)-1]
+}
+
+func TestCacheWithFakeUpstream(t *testing.T) {
+	server := fakepokeapi.NewServer()
+	defer server.Close()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "db.sqlite"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	client := &recordingClient{}
+
+	cache := cached_http.New(db, cached_http.Options{
+		Client:      client,
+		DefaultTTL:  time.Hour,
+		NotFoundTTL: time.Hour,
+	})
+
+	pikachuURL := server.BaseURL() + "/pokemon/pikachu"
+
+	t.Run("hit", func(t *testing.T) {
+		payload, err := cache.CacheAndRetrieve(pikachuURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var pokemon struct {
+			Name string `json:"name"`
+		}
+
+		err = json.Unmarshal(payload, &pokemon)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pokemon.Name != "pikachu" {
+			t.Errorf("got %q; want pikachu", pokemon.Name)
+		}
+
+		requests := client.count()
+
+		cached, err := cache.CacheAndRetrieve(pikachuURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if client.count() != requests {
+			t.Errorf("second lookup went upstream")
+		}
+
+		if string(cached) != string(payload) {
+			t.Errorf("second lookup returned a different payload")
+		}
+	})
+
+	t.Run("negatively cached 404", func(t *testing.T) {
+		missingURL := server.BaseURL() + "/pokemon/missingno"
+
+		_, err := cache.CacheAndRetrieve(missingURL)
+		if !errors.Is(err, cached_http.ErrNotFound) {
+			t.Fatalf("first lookup got error %v; want %v", err, cached_http.ErrNotFound)
+		}
+
+		requests := client.count()
+
+		_, err = cache.CacheAndRetrieve(missingURL)
+		if !errors.Is(err, cached_http.ErrNotFound) {
+			t.Fatalf("second lookup got error %v; want %v", err, cached_http.ErrNotFound)
+		}
+
+		if client.count() != requests {
+			t.Errorf("second lookup of a missing resource went upstream")
+		}
+	})
+
+	t.Run("ETag revalidation", func(t *testing.T) {
+		cached, err := cache.CacheAndRetrieve(pikachuURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A cache over the same database that finds every entry expired has
+		// to revalidate it
+		expiring := cached_http.New(db, cached_http.Options{
+			Client:     client,
+			DefaultTTL: time.Nanosecond,
+		})
+
+		requests := client.count()
+
+		payload, err := expiring.CacheAndRetrieve(pikachuURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if client.count() != requests+1 {
+			t.Fatalf("expired lookup sent %d upstream requests; want 1", client.count()-requests)
+		}
+
+		request, status := client.last()
+
+		if request.Header.Get("If-None-Match") == "" {
+			t.Errorf("expired lookup did not send If-None-Match")
+		}
+
+		if status != http.StatusNotModified {
+			t.Errorf("upstream answered the revalidation with %d; want %d", status, http.StatusNotModified)
+		}
+
+		if string(payload) != string(cached) {
+			t.Errorf("revalidated payload differs from the cached one")
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package cached_http
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when the upstream answered 404 for a URL, either just
+// now or within the negative caching window.
+var ErrNotFound = errors.New("upstream resource not found")
+
+// UpstreamError reports an upstream failure that was not cached, either an
+// unexpected status code or a transport error.
+type UpstreamError struct {
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("upstream request to %s failed: %s", e.URL, e.Err)
+	}
+
+	return fmt.Sprintf("upstream request to %s returned status %d", e.URL, e.StatusCode)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
@@ -2,43 +2,313 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 )
 
 type CachedResponse struct {
-	ID      int    `db:"id" json:"id"`
-	URL     string `db:"url" json:"url"`
-	Payload []byte `db:"payload" json:"payload"`
+	ID           int       `db:"id" json:"id"`
+	URL          string    `db:"url" json:"url"`
+	Payload      []byte    `db:"payload" json:"payload"`
+	FetchedAt    time.Time `db:"fetched_at" json:"fetched_at"`
+	ETag         string    `db:"etag" json:"etag"`
+	LastModified string    `db:"last_modified" json:"last_modified"`
+	StatusCode   int       `db:"status_code" json:"status_code"`
+
+	// Payload is always returned decoded, PayloadEncoding records how it is
+	// stored in the database.
+	PayloadEncoding string `db:"payload_encoding" json:"payload_encoding"`
+}
+
+func (cr *CachedResponse) decode() error {
+	payload, err := decodePayload(cr.Payload, cr.PayloadEncoding)
+	if err != nil {
+		return fmt.Errorf("cached response %d: %w", cr.ID, err)
+	}
+
+	cr.Payload = payload
+	return nil
 }
 
-func (db *DB) InsertCachedResponse(url string, payload []byte) (int, error) {
+func (db *DB) UpsertCachedResponse(url string, statusCode int, payload []byte, etag, lastModified string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
+	payload, encoding, err := encodePayload(payload)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO cached_responses (url, payload) VALUES ($1, $2)`
+		INSERT INTO cached_responses (url, status_code, payload, payload_encoding, fetched_at, etag, last_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (url) DO UPDATE
+		SET status_code = excluded.status_code, payload = excluded.payload,
+			payload_encoding = excluded.payload_encoding,
+			fetched_at = excluded.fetched_at, etag = excluded.etag,
+			last_modified = excluded.last_modified`
+
+	_, err = db.ExecContext(ctx, query, url, statusCode, payload, encoding, time.Now().UTC(), etag, lastModified)
+	return err
+}
+
+func (db *DB) GetCachedResponse(url string) (*CachedResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var cachedResponse CachedResponse
+
+	query := `SELECT * FROM cached_responses WHERE url = $1`
 
-	result, err := db.ExecContext(ctx, query, url, payload)
+	err := db.GetContext(ctx, &cachedResponse, query, url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	id, err := result.LastInsertId()
+	return &cachedResponse, cachedResponse.decode()
+}
+
+func (db *DB) TouchCachedResponse(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `UPDATE cached_responses SET fetched_at = $1 WHERE id = $2`
+
+	_, err := db.ExecContext(ctx, query, time.Now().UTC(), id)
+	return err
+}
+
+func (db *DB) DeleteCachedResponse(url string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `DELETE FROM cached_responses WHERE url = $1`
+
+	result, err := db.ExecContext(ctx, query, url)
 	if err != nil {
 		return 0, err
 	}
 
-	return int(id), err
+	rows, err := result.RowsAffected()
+	return int(rows), err
 }
 
-func (db *DB) GetCachedResponse(url string) (*CachedResponse, error) {
+type CachedResponseSummary struct {
+	ID         int       `db:"id"`
+	URL        string    `db:"url"`
+	StatusCode int       `db:"status_code"`
+	Size       int       `db:"size"`
+	Encoding   string    `db:"payload_encoding"`
+	FetchedAt  time.Time `db:"fetched_at"`
+}
+
+type CachedResponseTotals struct {
+	Count int   `db:"count"`
+	Bytes int64 `db:"bytes"`
+}
+
+func (db *DB) GetCachedResponseByID(id int) (*CachedResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
 	var cachedResponse CachedResponse
 
-	query := `SELECT * FROM cached_responses WHERE url = $1`
+	query := `SELECT * FROM cached_responses WHERE id = $1`
 
-	err := db.GetContext(ctx, &cachedResponse, query, url)
+	err := db.GetContext(ctx, &cachedResponse, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &cachedResponse, cachedResponse.decode()
+}
+
+func (db *DB) ListCachedResponses(offset, limit int) ([]*CachedResponseSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	summaries := []*CachedResponseSummary{}
+
+	query := `
+		SELECT id, url, status_code, length(payload) AS size, payload_encoding, fetched_at
+		FROM cached_responses
+		ORDER BY id
+		LIMIT $1 OFFSET $2`
+
+	err := db.SelectContext(ctx, &summaries, query, limit, offset)
+
+	return summaries, err
+}
+
+func (db *DB) GetCachedResponseTotals() (*CachedResponseTotals, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var totals CachedResponseTotals
+
+	query := `SELECT count(*) AS count, coalesce(sum(length(payload)), 0) AS bytes FROM cached_responses`
+
+	err := db.GetContext(ctx, &totals, query)
+
+	return &totals, err
+}
+
+func (db *DB) DeleteCachedResponsesByPrefix(prefix string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `DELETE FROM cached_responses WHERE substr(url, 1, length($1)) = $1`
+
+	result, err := db.ExecContext(ctx, query, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+func (db *DB) DeleteAllCachedResponses() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `DELETE FROM cached_responses`
+
+	result, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+type CachedResponseRecompression struct {
+	Rows        int
+	Compressed  int
+	BytesBefore int64
+	BytesAfter  int64
+}
+
+// RecompressCachedResponses re-encodes up to limit rows that are still stored
+// uncompressed, starting after the row with ID afterID. It returns the ID of
+// the last row it looked at so that callers can page through the table, and
+// zero once there are no rows left.
+func (db *DB) RecompressCachedResponses(afterID, limit int) (int, *CachedResponseRecompression, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var cachedResponses []*CachedResponse
+
+	query := `
+		SELECT * FROM cached_responses
+		WHERE payload_encoding = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`
+
+	err := db.SelectContext(ctx, &cachedResponses, query, EncodingIdentity, afterID, limit)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	recompression := &CachedResponseRecompression{}
+	lastID := 0
+
+	for _, cachedResponse := range cachedResponses {
+		lastID = cachedResponse.ID
+
+		payload, encoding, err := encodePayload(cachedResponse.Payload)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		recompression.Rows++
+		recompression.BytesBefore += int64(len(cachedResponse.Payload))
+		recompression.BytesAfter += int64(len(payload))
+
+		if encoding == EncodingIdentity {
+			continue
+		}
+
+		// Guard on the encoding in case the row was rewritten in the meantime
+		query := `
+			UPDATE cached_responses SET payload = $1, payload_encoding = $2
+			WHERE id = $3 AND payload_encoding = $4`
+
+		_, err = db.ExecContext(ctx, query, payload, encoding, cachedResponse.ID, EncodingIdentity)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		recompression.Compressed++
+	}
+
+	return lastID, recompression, nil
+}
+
+// ListCachedResponsesAfter returns up to limit decoded cached responses with
+// an ID greater than afterID, in ID order, for walking the whole table.
+func (db *DB) ListCachedResponsesAfter(afterID, limit int) ([]*CachedResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	cachedResponses := []*CachedResponse{}
+
+	query := `SELECT * FROM cached_responses WHERE id > $1 ORDER BY id LIMIT $2`
+
+	err := db.SelectContext(ctx, &cachedResponses, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cachedResponse := range cachedResponses {
+		err = cachedResponse.decode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cachedResponses, nil
+}
+
+// ImportCachedResponse inserts cachedResponse, keeping its FetchedAt. An
+// existing entry for the same URL is only replaced when it was fetched
+// earlier, unless overwriteNewer is set. It reports whether anything was
+// written. Fetch times are stored in UTC but compared with julianday(), as
+// entries written by older versions hold local times.
+func (db *DB) ImportCachedResponse(cachedResponse *CachedResponse, overwriteNewer bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	payload, encoding, err := encodePayload(cachedResponse.Payload)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		INSERT INTO cached_responses (url, status_code, payload, payload_encoding, fetched_at, etag, last_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (url) DO UPDATE
+		SET status_code = excluded.status_code, payload = excluded.payload,
+			payload_encoding = excluded.payload_encoding,
+			fetched_at = excluded.fetched_at, etag = excluded.etag,
+			last_modified = excluded.last_modified
+		WHERE $8 OR julianday(excluded.fetched_at) > julianday(cached_responses.fetched_at)`
+
+	result, err := db.ExecContext(ctx, query, cachedResponse.URL, cachedResponse.StatusCode, payload, encoding,
+		cachedResponse.FetchedAt.UTC(), cachedResponse.ETag, cachedResponse.LastModified, overwriteNewer)
+	if err != nil {
+		return false, err
+	}
 
-	return &cachedResponse, err
+	rows, err := result.RowsAffected()
+	return rows > 0, err
 }
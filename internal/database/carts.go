@@ -0,0 +1,333 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Limits of a cart. Merging carts never takes a cart past them.
+const (
+	// MaxCartItemQuantity is the most of a single product a cart can hold.
+	MaxCartItemQuantity = 99
+	// MaxCartItems is the most distinct products a cart can hold.
+	MaxCartItems = 50
+)
+
+var (
+	ErrCartItemQuantity = errors.New("cart item quantity over limit")
+	ErrCartFull         = errors.New("cart holds too many products")
+	ErrCartCurrency     = errors.New("cart holds products priced in different currencies")
+)
+
+// Cart belongs to a user or, if UserID is nil, to an anonymous client.
+type Cart struct {
+	ID      int       `db:"id"`
+	UserID  *int      `db:"user_id"`
+	Created time.Time `db:"created"`
+	Updated time.Time `db:"updated"`
+}
+
+type CartItem struct {
+	ProductID int       `db:"product_id"`
+	Quantity  int       `db:"quantity"`
+	Added     time.Time `db:"added"`
+}
+
+// CartReservation is the reference stock is reserved under while a cart is
+// being checked out.
+func CartReservation(cartID int) string {
+	return fmt.Sprintf("cart:%d", cartID)
+}
+
+func (db *DB) InsertCart(userID *int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	query := `INSERT INTO carts (user_id, created, updated) VALUES ($1, $2, $3)`
+
+	result, err := db.ExecContext(ctx, query, userID, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cart{ID: int(id), UserID: userID, Created: now, Updated: now}, nil
+}
+
+// GetAnonymousCart returns the cart with the given ID, provided that it does
+// not belong to a user.
+func (db *DB) GetAnonymousCart(id int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var cart Cart
+
+	query := `SELECT * FROM carts WHERE id = $1 AND user_id IS NULL`
+
+	err := db.GetContext(ctx, &cart, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &cart, err
+}
+
+func (db *DB) GetCartByUserID(userID int) (*Cart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var cart Cart
+
+	query := `SELECT * FROM carts WHERE user_id = $1`
+
+	err := db.GetContext(ctx, &cart, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &cart, err
+}
+
+// GetCartItems returns the items in a cart in the order they were added.
+func (db *DB) GetCartItems(cartID int) ([]*CartItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	items := []*CartItem{}
+
+	query := `SELECT product_id, quantity, added FROM cart_items WHERE cart_id = $1 ORDER BY added, product_id`
+
+	err := db.SelectContext(ctx, &items, query, cartID)
+	return items, err
+}
+
+// SetCartItem puts quantity of a product in a cart, replacing the quantity
+// already there. It fails like AddCartItem if the cart would end up past its
+// limits, and leaves the cart as it was.
+func (db *DB) SetCartItem(cartID, productID, quantity int) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		now := time.Now()
+
+		query := `
+			INSERT INTO cart_items (cart_id, product_id, quantity, added) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = excluded.quantity`
+
+		_, err := tx.ExecContext(ctx, query, cartID, productID, quantity, now)
+		if err != nil {
+			return err
+		}
+
+		err = checkCartLimits(ctx, tx, cartID, productID, now)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET updated = $1 WHERE id = $2`, now, cartID)
+		return err
+	})
+}
+
+// AddCartItem adds quantity of a product to a cart, on top of any quantity
+// already there. The product's new quantity must not exceed
+// MaxCartItemQuantity or the stock available, and the cart must not end up
+// with more than MaxCartItems products or with products priced in different
+// currencies. Otherwise ErrCartItemQuantity, an *InsufficientStockError,
+// ErrCartFull or ErrCartCurrency is returned and the cart is left as it was.
+func (db *DB) AddCartItem(cartID, productID, quantity int) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		now := time.Now()
+
+		query := `
+			INSERT INTO cart_items (cart_id, product_id, quantity, added) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = cart_items.quantity + excluded.quantity`
+
+		_, err := tx.ExecContext(ctx, query, cartID, productID, quantity, now)
+		if err != nil {
+			return err
+		}
+
+		err = checkCartLimits(ctx, tx, cartID, productID, now)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET updated = $1 WHERE id = $2`, now, cartID)
+		return err
+	})
+}
+
+// checkCartLimits returns ErrCartItemQuantity, an *InsufficientStockError,
+// ErrCartFull or ErrCartCurrency if the product's quantity in the cart, or the
+// cart as a whole, is past its limits.
+func checkCartLimits(ctx context.Context, tx *sqlx.Tx, cartID, productID int, now time.Time) error {
+	var total int
+
+	err := tx.GetContext(ctx, &total, `SELECT quantity FROM cart_items WHERE cart_id = $1 AND product_id = $2`, cartID, productID)
+	if err != nil {
+		return err
+	}
+
+	if total > MaxCartItemQuantity {
+		return ErrCartItemQuantity
+	}
+
+	var level InventoryLevel
+
+	err = tx.GetContext(ctx, &level, inventoryLevelQuery+` WHERE p.id = $2`, now.UTC(), productID)
+	if err != nil {
+		return err
+	}
+
+	if total > level.Available {
+		return &InsufficientStockError{ProductID: productID}
+	}
+
+	var contents struct {
+		Products   int `db:"products"`
+		Currencies int `db:"currencies"`
+	}
+
+	query := `
+		SELECT count(*) AS products, count(DISTINCT p.currency) AS currencies
+		FROM cart_items ci
+		JOIN products p ON p.id = ci.product_id
+		WHERE ci.cart_id = $1`
+
+	err = tx.GetContext(ctx, &contents, query, cartID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case contents.Products > MaxCartItems:
+		return ErrCartFull
+	case contents.Currencies > 1:
+		return ErrCartCurrency
+	}
+
+	return nil
+}
+
+// DeleteCartItem removes a product from a cart, reporting whether it was
+// there.
+func (db *DB) DeleteCartItem(cartID, productID int) (bool, error) {
+	var deleted bool
+
+	err := db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2`, cartID, productID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		deleted = affected > 0
+
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET updated = $1 WHERE id = $2`, time.Now(), cartID)
+		return err
+	})
+
+	return deleted, err
+}
+
+// MergeCarts moves every item in the cart fromID into the cart intoID,
+// adding to the quantities already there, then deletes the cart fromID and
+// releases any stock either cart had reserved. Items that would take the
+// cart past its limits, or are priced in a different currency from the items
+// already in it, are left out.
+func (db *DB) MergeCarts(fromID, intoID int) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		now := time.Now()
+
+		_, err := tx.ExecContext(ctx, `UPDATE carts SET updated = $1 WHERE id = $2`, now, intoID)
+		if err != nil {
+			return err
+		}
+
+		type mergeItem struct {
+			ProductID int    `db:"product_id"`
+			Quantity  int    `db:"quantity"`
+			Currency  string `db:"currency"`
+		}
+
+		query := `
+			SELECT ci.product_id, ci.quantity, p.currency
+			FROM cart_items ci
+			JOIN products p ON p.id = ci.product_id
+			WHERE ci.cart_id = $1
+			ORDER BY ci.added, ci.product_id`
+
+		var into, from []mergeItem
+
+		err = tx.SelectContext(ctx, &into, query, intoID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.SelectContext(ctx, &from, query, fromID)
+		if err != nil {
+			return err
+		}
+
+		held := make(map[int]bool, len(into))
+		for _, item := range into {
+			held[item.ProductID] = true
+		}
+
+		var currency string
+		if len(into) > 0 {
+			currency = into[0].Currency
+		}
+
+		for _, item := range from {
+			if currency == "" {
+				currency = item.Currency
+			}
+
+			if item.Currency != currency || (!held[item.ProductID] && len(held) >= MaxCartItems) {
+				continue
+			}
+
+			query := `
+				INSERT INTO cart_items (cart_id, product_id, quantity, added) VALUES ($1, $2, min($3, $4), $5)
+				ON CONFLICT (cart_id, product_id) DO UPDATE
+				SET quantity = min(cart_items.quantity + excluded.quantity, $4)`
+
+			_, err = tx.ExecContext(ctx, query, intoID, item.ProductID, item.Quantity, MaxCartItemQuantity, now)
+			if err != nil {
+				return err
+			}
+
+			held[item.ProductID] = true
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = $1`, fromID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM carts WHERE id = $1`, fromID)
+		if err != nil {
+			return err
+		}
+
+		query = `DELETE FROM inventory_reservations WHERE reference IN ($1, $2)`
+
+		_, err = tx.ExecContext(ctx, query, CartReservation(fromID), CartReservation(intoID))
+		return err
+	})
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The catalog is a normalized copy of the Pokémon data held as JSON in
+// cached_responses, kept so that the store can query it with SQL.
+
+type CatalogResource struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+type CatalogPokemonType struct {
+	Slot int
+	Type CatalogResource
+}
+
+type CatalogPokemonAbility struct {
+	Slot     int
+	IsHidden bool
+	Ability  CatalogResource
+}
+
+type CatalogPokemonStat struct {
+	Stat     CatalogResource
+	BaseStat int
+	Effort   int
+}
+
+type CatalogPokemon struct {
+	ID             int       `db:"id"`
+	Name           string    `db:"name"`
+	Species        string    `db:"species"`
+	Generation     int       `db:"generation"`
+	Height         int       `db:"height"`
+	Weight         int       `db:"weight"`
+	BaseExperience int       `db:"base_experience"`
+	IsDefault      bool      `db:"is_default"`
+	Order          int       `db:"sort_order"`
+	SpriteURL      string    `db:"sprite_url"`
+	SyncedAt       time.Time `db:"synced_at"`
+
+	Types     []CatalogPokemonType    `db:"-"`
+	Abilities []CatalogPokemonAbility `db:"-"`
+	Stats     []CatalogPokemonStat    `db:"-"`
+	Moves     []CatalogResource       `db:"-"`
+}
+
+type CatalogTotals struct {
+	Pokemon      int        `db:"pokemon"`
+	Types        int        `db:"types"`
+	Abilities    int        `db:"abilities"`
+	Stats        int        `db:"stats"`
+	Moves        int        `db:"moves"`
+	LastSyncedAt *time.Time `db:"-"`
+}
+
+// UpsertCatalogPokemon writes pokemon and replaces its types, abilities, stats
+// and moves in a single transaction, adding any resources not seen before.
+func (db *DB) UpsertCatalogPokemon(pokemon *CatalogPokemon) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO pokemon (id, name, species, generation, height, weight, base_experience, is_default, sort_order, sprite_url, synced_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (id) DO UPDATE
+			SET name = excluded.name, species = excluded.species, generation = excluded.generation, height = excluded.height,
+				weight = excluded.weight, base_experience = excluded.base_experience,
+				is_default = excluded.is_default, sort_order = excluded.sort_order,
+				sprite_url = excluded.sprite_url, synced_at = excluded.synced_at`
+
+		_, err := tx.ExecContext(ctx, query, pokemon.ID, pokemon.Name, pokemon.Species, pokemon.Generation, pokemon.Height, pokemon.Weight,
+			pokemon.BaseExperience, pokemon.IsDefault, pokemon.Order, pokemon.SpriteURL, time.Now())
+		if err != nil {
+			return err
+		}
+
+		for _, table := range []string{"pokemon_types", "pokemon_abilities", "pokemon_stats", "pokemon_moves"} {
+			_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE pokemon_id = $1`, pokemon.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		upsertResource := func(table string, resource CatalogResource) error {
+			query := `INSERT INTO ` + table + ` (id, name) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET name = excluded.name`
+
+			_, err := tx.ExecContext(ctx, query, resource.ID, resource.Name)
+			return err
+		}
+
+		for _, pokemonType := range pokemon.Types {
+			err = upsertResource("types", pokemonType.Type)
+			if err != nil {
+				return err
+			}
+
+			query := `INSERT INTO pokemon_types (pokemon_id, type_id, slot) VALUES ($1, $2, $3)`
+
+			_, err = tx.ExecContext(ctx, query, pokemon.ID, pokemonType.Type.ID, pokemonType.Slot)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, ability := range pokemon.Abilities {
+			err = upsertResource("abilities", ability.Ability)
+			if err != nil {
+				return err
+			}
+
+			query := `INSERT INTO pokemon_abilities (pokemon_id, ability_id, slot, is_hidden) VALUES ($1, $2, $3, $4)`
+
+			_, err = tx.ExecContext(ctx, query, pokemon.ID, ability.Ability.ID, ability.Slot, ability.IsHidden)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, stat := range pokemon.Stats {
+			err = upsertResource("stats", stat.Stat)
+			if err != nil {
+				return err
+			}
+
+			query := `INSERT INTO pokemon_stats (pokemon_id, stat_id, base_stat, effort) VALUES ($1, $2, $3, $4)`
+
+			_, err = tx.ExecContext(ctx, query, pokemon.ID, stat.Stat.ID, stat.BaseStat, stat.Effort)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, move := range pokemon.Moves {
+			err = upsertResource("moves", move)
+			if err != nil {
+				return err
+			}
+
+			query := `INSERT INTO pokemon_moves (pokemon_id, move_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+			_, err = tx.ExecContext(ctx, query, pokemon.ID, move.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *DB) GetCatalogTotals() (*CatalogTotals, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var totals CatalogTotals
+
+	query := `
+		SELECT
+			(SELECT count(*) FROM pokemon) AS pokemon,
+			(SELECT count(*) FROM types) AS types,
+			(SELECT count(*) FROM abilities) AS abilities,
+			(SELECT count(*) FROM stats) AS stats,
+			(SELECT count(*) FROM moves) AS moves`
+
+	err := db.GetContext(ctx, &totals, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastSyncedAt []time.Time
+
+	query = `SELECT synced_at FROM pokemon ORDER BY synced_at DESC LIMIT 1`
+
+	err = db.SelectContext(ctx, &lastSyncedAt, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lastSyncedAt) > 0 {
+		totals.LastSyncedAt = &lastSyncedAt[0]
+	}
+
+	return &totals, nil
+}
+
+// CatalogResourceExists reports whether a type, ability, stat or move with
+// the given name is in the catalog. table must be one of the resource tables.
+func (db *DB) CatalogResourceExists(table, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var exists bool
+
+	query := `SELECT EXISTS(SELECT 1 FROM ` + table + ` WHERE name = $1)`
+
+	err := db.GetContext(ctx, &exists, query, name)
+
+	return exists, err
+}
+
+// CatalogFilter narrows and orders a FilterCatalogPokemon query. Zero values
+// are not filtered on. Stats are keyed by their catalog names, e.g.
+// "special-attack".
+type CatalogFilter struct {
+	Type       string
+	Ability    string
+	Generation int
+	MinStats   map[string]int
+	MaxStats   map[string]int
+
+	// Sort is "id", "name" or a stat name, ties are broken by ID.
+	Sort       string
+	Descending bool
+
+	Offset int
+	Limit  int
+}
+
+// FilterCatalogPokemon returns a page of the Pokémon that match filter and
+// the total number of matches.
+func (db *DB) FilterCatalogPokemon(filter CatalogFilter) ([]*CatalogResource, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var args []any
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	statQuery := func(stat string) string {
+		return `
+			(SELECT ps.base_stat FROM pokemon_stats ps JOIN stats s ON s.id = ps.stat_id
+			WHERE ps.pokemon_id = p.id AND s.name = ` + arg(stat) + `)`
+	}
+
+	where := []string{"1 = 1"}
+
+	if filter.Type != "" {
+		where = append(where, `
+			EXISTS (SELECT 1 FROM pokemon_types pt JOIN types t ON t.id = pt.type_id
+			WHERE pt.pokemon_id = p.id AND t.name = `+arg(filter.Type)+`)`)
+	}
+
+	if filter.Ability != "" {
+		where = append(where, `
+			EXISTS (SELECT 1 FROM pokemon_abilities pa JOIN abilities a ON a.id = pa.ability_id
+			WHERE pa.pokemon_id = p.id AND a.name = `+arg(filter.Ability)+`)`)
+	}
+
+	if filter.Generation != 0 {
+		where = append(where, "p.generation = "+arg(filter.Generation))
+	}
+
+	for _, stat := range sortedKeys(filter.MinStats) {
+		where = append(where, statQuery(stat)+" >= "+arg(filter.MinStats[stat]))
+	}
+
+	for _, stat := range sortedKeys(filter.MaxStats) {
+		where = append(where, statQuery(stat)+" <= "+arg(filter.MaxStats[stat]))
+	}
+
+	conditions := strings.Join(where, " AND ")
+
+	var count int
+
+	query := `SELECT count(*) FROM pokemon p WHERE ` + conditions
+
+	err := db.GetContext(ctx, &count, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	var orderBy string
+	switch filter.Sort {
+	case "", "id":
+		orderBy = "p.id " + direction
+	case "name":
+		orderBy = "p.name " + direction
+	default:
+		orderBy = statQuery(filter.Sort) + " " + direction + ", p.id"
+	}
+
+	results := []*CatalogResource{}
+
+	query = `
+		SELECT p.id, p.name FROM pokemon p
+		WHERE ` + conditions + `
+		ORDER BY ` + orderBy + `
+		LIMIT ` + arg(filter.Limit) + ` OFFSET ` + arg(filter.Offset)
+
+	err = db.SelectContext(ctx, &results, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return results, count, nil
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+type CatalogSearchTerm struct {
+	PokemonID   int    `db:"pokemon_id"`
+	PokemonName string `db:"pokemon_name"`
+	Kind        string `db:"kind"`
+	Name        string `db:"name"`
+}
+
+// ListCatalogSearchTerms returns every Pokémon with the names it can be found
+// by: its own ("name"), its abilities' ("ability") and its moves' ("move").
+func (db *DB) ListCatalogSearchTerms() ([]*CatalogSearchTerm, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	terms := []*CatalogSearchTerm{}
+
+	query := `
+		SELECT id AS pokemon_id, name AS pokemon_name, 'name' AS kind, name FROM pokemon
+		UNION ALL
+		SELECT p.id, p.name, 'ability', a.name FROM pokemon p
+		JOIN pokemon_abilities pa ON pa.pokemon_id = p.id
+		JOIN abilities a ON a.id = pa.ability_id
+		UNION ALL
+		SELECT p.id, p.name, 'move', m.name FROM pokemon p
+		JOIN pokemon_moves pm ON pm.pokemon_id = p.id
+		JOIN moves m ON m.id = pm.move_id`
+
+	err := db.SelectContext(ctx, &terms, query)
+
+	return terms, err
+}
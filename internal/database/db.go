@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -64,3 +65,25 @@ func New(dsn string, automigrate bool) (*DB, error) {
 
 	return &DB{db}, nil
 }
+
+// Transaction runs fn in a transaction, which is committed if fn returns nil
+// and rolled back otherwise. SQLite allows one writer at a time, and a
+// transaction that reads before it writes fails instead of waiting if another
+// writer commits in between, so fn should start with a write where it can.
+func (db *DB) Transaction(fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,370 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Stock is counted per product, and so per SKU. Reservations hold stock back
+// for a limited time, e.g. while a cart is being checked out, and stop
+// counting once they expire, whether or not they have been swept away yet.
+// Times are stored in UTC so that they compare correctly as text.
+
+// InsufficientStockError reports a product that does not have the quantity
+// asked for available.
+type InsufficientStockError struct {
+	ProductID int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock of product %d", e.ProductID)
+}
+
+type StockItem struct {
+	ProductID int `db:"product_id"`
+	Quantity  int `db:"quantity"`
+}
+
+type InventoryLevel struct {
+	ProductID int        `db:"product_id"`
+	SKU       string     `db:"sku"`
+	OnHand    int        `db:"on_hand"`
+	Reserved  int        `db:"reserved"`
+	Available int        `db:"available"`
+	Updated   *time.Time `db:"updated"`
+}
+
+// InventoryAdjustment is an entry in the inventory ledger. UserID is the
+// admin who made the change, or nil for changes made by the store itself,
+// such as sales.
+type InventoryAdjustment struct {
+	ID        int       `db:"id"`
+	ProductID int       `db:"product_id"`
+	SKU       string    `db:"sku"`
+	UserID    *int      `db:"user_id"`
+	Delta     int       `db:"delta"`
+	OnHand    int       `db:"on_hand"`
+	Reason    string    `db:"reason"`
+	Created   time.Time `db:"created"`
+}
+
+// inventoryLevelQuery selects the stock of every product, including products
+// that have never been stocked. $1 is the current time.
+const inventoryLevelQuery = `
+	SELECT p.id AS product_id, p.sku, coalesce(i.on_hand, 0) AS on_hand, r.reserved,
+		max(coalesce(i.on_hand, 0) - r.reserved, 0) AS available, i.updated
+	FROM products p
+	LEFT JOIN inventory i ON i.product_id = p.id
+	JOIN (
+		SELECT p.id AS product_id, coalesce(sum(ir.quantity), 0) AS reserved
+		FROM products p
+		LEFT JOIN inventory_reservations ir ON ir.product_id = p.id AND ir.expires > $1
+		GROUP BY p.id
+	) r ON r.product_id = p.id`
+
+func (db *DB) GetInventoryLevel(productID int) (*InventoryLevel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var level InventoryLevel
+
+	query := inventoryLevelQuery + ` WHERE p.id = $2`
+
+	err := db.GetContext(ctx, &level, query, time.Now().UTC(), productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &level, err
+}
+
+func (db *DB) ListInventoryLevels(offset, limit int) ([]*InventoryLevel, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var count int
+
+	err := db.GetContext(ctx, &count, `SELECT count(*) FROM products`)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	levels := []*InventoryLevel{}
+
+	query := inventoryLevelQuery + ` ORDER BY p.id LIMIT $2 OFFSET $3`
+
+	err = db.SelectContext(ctx, &levels, query, time.Now().UTC(), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return levels, count, nil
+}
+
+// adjustStock changes the stock of a product by delta within tx and records
+// the change in the ledger. The stock left must not drop below minimum.
+func adjustStock(ctx context.Context, tx *sqlx.Tx, productID, delta, minimum int, userID *int, reason string) (*InventoryAdjustment, error) {
+	now := time.Now().UTC()
+
+	query := `
+		INSERT INTO inventory (product_id, on_hand, updated) VALUES ($1, 0, $2)
+		ON CONFLICT (product_id) DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, productID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		UPDATE inventory SET on_hand = on_hand + $1, updated = $2
+		WHERE product_id = $3 AND on_hand + $1 >= max($4, 0)`
+
+	result, err := tx.ExecContext(ctx, query, delta, now, productID, minimum)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affected == 0 {
+		return nil, &InsufficientStockError{ProductID: productID}
+	}
+
+	adjustment := InventoryAdjustment{
+		ProductID: productID,
+		UserID:    userID,
+		Delta:     delta,
+		Reason:    reason,
+		Created:   now,
+	}
+
+	query = `
+		SELECT p.sku, i.on_hand FROM products p
+		JOIN inventory i ON i.product_id = p.id
+		WHERE p.id = $1`
+
+	err = tx.QueryRowxContext(ctx, query, productID).Scan(&adjustment.SKU, &adjustment.OnHand)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO inventory_adjustments (product_id, sku, user_id, delta, on_hand, reason, created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	result, err = tx.ExecContext(ctx, query, adjustment.ProductID, adjustment.SKU, adjustment.UserID, adjustment.Delta,
+		adjustment.OnHand, adjustment.Reason, adjustment.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	adjustment.ID = int(id)
+
+	return &adjustment, nil
+}
+
+// AdjustInventory adds delta, which may be negative, to the stock of a
+// product and records who changed it and why. Stock can not drop below zero,
+// but may drop below what is reserved.
+func (db *DB) AdjustInventory(productID, delta int, userID *int, reason string) (*InventoryAdjustment, error) {
+	var adjustment *InventoryAdjustment
+
+	err := db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		var err error
+		adjustment, err = adjustStock(ctx, tx, productID, delta, 0, userID, reason)
+		return err
+	})
+
+	return adjustment, err
+}
+
+// SetInventory sets the stock of a product to onHand, as after a stock take,
+// and records the difference as an adjustment.
+func (db *DB) SetInventory(productID, onHand int, userID *int, reason string) (*InventoryAdjustment, error) {
+	var adjustment *InventoryAdjustment
+
+	err := db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO inventory (product_id, on_hand, updated) VALUES ($1, 0, $2)
+			ON CONFLICT (product_id) DO NOTHING`
+
+		_, err := tx.ExecContext(ctx, query, productID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		var current int
+
+		err = tx.GetContext(ctx, &current, `SELECT on_hand FROM inventory WHERE product_id = $1`, productID)
+		if err != nil {
+			return err
+		}
+
+		adjustment, err = adjustStock(ctx, tx, productID, onHand-current, 0, userID, reason)
+		return err
+	})
+
+	return adjustment, err
+}
+
+// DecrementStock takes items out of stock in a single transaction, so that
+// either all of them are taken or, if any is short, none are and an
+// *InsufficientStockError is returned. Stock reserved under reference counts
+// as available, and those reservations are released.
+func (db *DB) DecrementStock(reference string, items []StockItem, reason string) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		return decrementStock(ctx, tx, reference, items, reason)
+	})
+}
+
+func decrementStock(ctx context.Context, tx *sqlx.Tx, reference string, items []StockItem, reason string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM inventory_reservations WHERE reference = $1`, reference)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var reserved int
+
+		query := `
+			SELECT coalesce(sum(quantity), 0) FROM inventory_reservations
+			WHERE product_id = $1 AND expires > $2`
+
+		err := tx.GetContext(ctx, &reserved, query, item.ProductID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = adjustStock(ctx, tx, item.ProductID, -item.Quantity, reserved, nil, reason)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReserveStock holds items back under reference until expires, replacing
+// anything already reserved under it. Either all of the items are reserved
+// or, if any is short, none are and an *InsufficientStockError is returned.
+func (db *DB) ReserveStock(reference string, items []StockItem, expires time.Time) error {
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM inventory_reservations WHERE reference = $1`, reference)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+
+		for _, item := range items {
+			query := `
+				INSERT INTO inventory_reservations (product_id, reference, quantity, created, expires)
+				SELECT $1, $2, $3, $4, $5
+				WHERE coalesce((SELECT on_hand FROM inventory WHERE product_id = $1), 0) - (
+					SELECT coalesce(sum(quantity), 0) FROM inventory_reservations
+					WHERE product_id = $1 AND expires > $4
+				) >= $3`
+
+			result, err := tx.ExecContext(ctx, query, item.ProductID, reference, item.Quantity, now, expires.UTC())
+			if err != nil {
+				return err
+			}
+
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			if affected == 0 {
+				return &InsufficientStockError{ProductID: item.ProductID}
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetReservationExpiry returns when the stock reserved under reference stops
+// being held, or nil if none is.
+func (db *DB) GetReservationExpiry(reference string) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var expires []time.Time
+
+	query := `SELECT expires FROM inventory_reservations WHERE reference = $1 AND expires > $2 ORDER BY expires LIMIT 1`
+
+	err := db.SelectContext(ctx, &expires, query, reference, time.Now().UTC())
+	if err != nil || len(expires) == 0 {
+		return nil, err
+	}
+
+	return &expires[0], nil
+}
+
+func (db *DB) ReleaseReservation(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM inventory_reservations WHERE reference = $1`, reference)
+	return err
+}
+
+// DeleteExpiredReservations deletes every reservation that has expired and
+// returns how many there were.
+func (db *DB) DeleteExpiredReservations() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM inventory_reservations WHERE expires <= $1`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// ListInventoryAdjustments returns a page of the ledger, newest first, for a
+// single product or, if productID is zero, for all of them.
+func (db *DB) ListInventoryAdjustments(productID, offset, limit int) ([]*InventoryAdjustment, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var count int
+
+	query := `SELECT count(*) FROM inventory_adjustments WHERE $1 = 0 OR product_id = $1`
+
+	err := db.GetContext(ctx, &count, query, productID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	adjustments := []*InventoryAdjustment{}
+
+	query = `
+		SELECT * FROM inventory_adjustments
+		WHERE $1 = 0 OR product_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+
+	err = db.SelectContext(ctx, &adjustments, query, productID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return adjustments, count, nil
+}
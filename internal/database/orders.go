@@ -0,0 +1,381 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Order statuses. Orders start out pending and move through paid, fulfilled
+// and completed, or end up cancelled or refunded.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+var OrderStatuses = []string{OrderPending, OrderPaid, OrderFulfilled, OrderCompleted, OrderCancelled, OrderRefunded}
+
+// orderTransitions lists the statuses each status may move to.
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderFulfilled, OrderRefunded},
+	OrderFulfilled: {OrderCompleted, OrderRefunded},
+	OrderCompleted: {OrderRefunded},
+}
+
+// OrderTransitions returns the statuses an order may move to from status.
+func OrderTransitions(status string) []string {
+	return orderTransitions[status]
+}
+
+func CanTransitionOrder(from, to string) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// InvalidTransitionError reports an order status change that the state
+// machine does not allow.
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order can not move from %s to %s", e.From, e.To)
+}
+
+// ErrOrderStatusChanged is returned when an order's status changes between
+// being read and being transitioned.
+var ErrOrderStatusChanged = errors.New("order status changed")
+
+// Order is immutable once placed, apart from its status. Its items keep the
+// product details and prices they were ordered at.
+type Order struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	Status    string    `db:"status"`
+	Currency  string    `db:"currency"`
+	Total     int64     `db:"total"`
+	ItemCount int       `db:"item_count"`
+	Created   time.Time `db:"created"`
+	Updated   time.Time `db:"updated"`
+}
+
+type OrderItem struct {
+	ProductID   int    `db:"product_id"`
+	SKU         string `db:"sku"`
+	Name        string `db:"name"`
+	PokemonID   int    `db:"pokemon_id"`
+	PokemonName string `db:"pokemon_name"`
+	Variant     string `db:"variant"`
+	Level       int    `db:"level"`
+	UnitPrice   int64  `db:"unit_price"`
+	Quantity    int    `db:"quantity"`
+	Subtotal    int64  `db:"subtotal"`
+}
+
+// OrderHistoryEntry records a change of an order's status. FromStatus is nil
+// for the order being placed, and UserID nil for changes made by the store
+// itself, such as payment notifications.
+type OrderHistoryEntry struct {
+	ID         int       `db:"id"`
+	FromStatus *string   `db:"from_status"`
+	ToStatus   string    `db:"to_status"`
+	UserID     *int      `db:"user_id"`
+	Note       string    `db:"note"`
+	Created    time.Time `db:"created"`
+}
+
+func insertOrderHistory(ctx context.Context, tx *sqlx.Tx, orderID int, from *string, to string, userID *int, note string, created time.Time) error {
+	query := `
+		INSERT INTO order_history (order_id, from_status, to_status, user_id, note, created)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := tx.ExecContext(ctx, query, orderID, from, to, userID, note, created)
+	return err
+}
+
+// CreateOrder places a pending order for items and takes them out of stock,
+// counting stock reserved under reservation as available, then empties the
+// cart, all in a single transaction. If any item is short an
+// *InsufficientStockError is returned and nothing changes.
+func (db *DB) CreateOrder(userID, cartID int, currency string, items []OrderItem, reservation string) (*Order, error) {
+	now := time.Now()
+
+	order := &Order{
+		UserID:   userID,
+		Status:   OrderPending,
+		Currency: currency,
+		Created:  now,
+		Updated:  now,
+	}
+
+	for _, item := range items {
+		order.Total += item.Subtotal
+		order.ItemCount += item.Quantity
+	}
+
+	err := db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO orders (user_id, status, currency, total, item_count, created, updated)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+		result, err := tx.ExecContext(ctx, query, order.UserID, order.Status, order.Currency, order.Total, order.ItemCount, now, now)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		order.ID = int(id)
+
+		stock := make([]StockItem, len(items))
+
+		for i, item := range items {
+			query := `
+				INSERT INTO order_items (order_id, product_id, sku, name, pokemon_id, pokemon_name, variant, level, unit_price, quantity, subtotal)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+			_, err := tx.ExecContext(ctx, query, order.ID, item.ProductID, item.SKU, item.Name, item.PokemonID, item.PokemonName,
+				item.Variant, item.Level, item.UnitPrice, item.Quantity, item.Subtotal)
+			if err != nil {
+				return err
+			}
+
+			stock[i] = StockItem{ProductID: item.ProductID, Quantity: item.Quantity}
+		}
+
+		err = decrementStock(ctx, tx, reservation, stock, fmt.Sprintf("Order %d placed", order.ID))
+		if err != nil {
+			return err
+		}
+
+		err = insertOrderHistory(ctx, tx, order.ID, nil, OrderPending, &userID, "Order placed", now)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = $1`, cartID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (db *DB) GetOrder(id int) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var order Order
+
+	query := `SELECT * FROM orders WHERE id = $1`
+
+	err := db.GetContext(ctx, &order, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &order, err
+}
+
+func (db *DB) GetOrderItems(orderID int) ([]*OrderItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	items := []*OrderItem{}
+
+	query := `
+		SELECT product_id, sku, name, pokemon_id, pokemon_name, variant, level, unit_price, quantity, subtotal
+		FROM order_items WHERE order_id = $1 ORDER BY sku`
+
+	err := db.SelectContext(ctx, &items, query, orderID)
+	return items, err
+}
+
+// GetOrderHistory returns the status changes of an order, oldest first.
+func (db *DB) GetOrderHistory(orderID int) ([]*OrderHistoryEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	history := []*OrderHistoryEntry{}
+
+	query := `
+		SELECT id, from_status, to_status, user_id, note, created
+		FROM order_history WHERE order_id = $1 ORDER BY id`
+
+	err := db.SelectContext(ctx, &history, query, orderID)
+	return history, err
+}
+
+// TransitionOrder moves an order from status from to status to and records
+// the change in its history. Orders that are cancelled or refunded before they
+// were fulfilled put their items back in stock, and the payments that were
+// authorised or captured for cancelled or refunded orders are marked as due
+// a refund.
+//
+// It returns an *InvalidTransitionError if the state machine does not allow
+// the change, and ErrOrderStatusChanged if the order is no longer in status
+// from.
+func (db *DB) TransitionOrder(id int, from, to string, userID *int, note string) error {
+	if !CanTransitionOrder(from, to) {
+		return &InvalidTransitionError{From: from, To: to}
+	}
+
+	return db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		now := time.Now()
+
+		query := `UPDATE orders SET status = $1, updated = $2 WHERE id = $3 AND status = $4`
+
+		result, err := tx.ExecContext(ctx, query, to, now, id, from)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrOrderStatusChanged
+		}
+
+		err = insertOrderHistory(ctx, tx, id, &from, to, userID, note, now)
+		if err != nil {
+			return err
+		}
+
+		if to != OrderCancelled && to != OrderRefunded {
+			return nil
+		}
+
+		query = `
+			UPDATE payments SET refund_due = true, updated = $1
+			WHERE order_id = $2 AND status IN ('succeeded', 'requires_capture')`
+
+		_, err = tx.ExecContext(ctx, query, now, id)
+		if err != nil {
+			return err
+		}
+
+		if from == OrderPending || from == OrderPaid {
+			var items []StockItem
+
+			err = tx.SelectContext(ctx, &items, `SELECT product_id, quantity FROM order_items WHERE order_id = $1`, id)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range items {
+				var exists bool
+
+				err = tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, item.ProductID)
+				if err != nil {
+					return err
+				}
+
+				// Products deleted since the order was placed have no stock to
+				// return to
+				if !exists {
+					continue
+				}
+
+				_, err = adjustStock(ctx, tx, item.ProductID, item.Quantity, 0, userID, fmt.Sprintf("Order %d %s", id, to))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// OrderFilter narrows a ListOrders query. Zero values are not filtered on.
+type OrderFilter struct {
+	UserID int
+	Email  string
+	Status string
+	SKU    string
+
+	Offset int
+	Limit  int
+}
+
+// ListOrders returns a page of the orders that match filter, newest first,
+// and the total number of matches.
+func (db *DB) ListOrders(filter OrderFilter) ([]*Order, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var args []any
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"1 = 1"}
+
+	if filter.UserID != 0 {
+		where = append(where, "o.user_id = "+arg(filter.UserID))
+	}
+
+	if filter.Email != "" {
+		where = append(where, "o.user_id IN (SELECT id FROM users WHERE email = "+arg(filter.Email)+")")
+	}
+
+	if filter.Status != "" {
+		where = append(where, "o.status = "+arg(filter.Status))
+	}
+
+	if filter.SKU != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = o.id AND oi.sku = "+arg(filter.SKU)+")")
+	}
+
+	conditions := strings.Join(where, " AND ")
+
+	var count int
+
+	query := `SELECT count(*) FROM orders o WHERE ` + conditions
+
+	err := db.GetContext(ctx, &count, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orders := []*Order{}
+
+	query = `
+		SELECT o.* FROM orders o
+		WHERE ` + conditions + `
+		ORDER BY o.id DESC
+		LIMIT ` + arg(filter.Limit) + ` OFFSET ` + arg(filter.Offset)
+
+	err = db.SelectContext(ctx, &orders, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return orders, count, nil
+}
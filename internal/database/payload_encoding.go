@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Payload encodings recorded in cached_responses.payload_encoding, named after
+// the equivalent HTTP Content-Encoding values. Rows written before the column
+// existed default to EncodingIdentity.
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+)
+
+// encodePayload compresses payload with gzip, falling back to storing it as is
+// when that would not make it any smaller (e.g. short "Not Found" bodies).
+func encodePayload(payload []byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = zw.Write(payload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if buf.Len() >= len(payload) {
+		return payload, EncodingIdentity, nil
+	}
+
+	return buf.Bytes(), EncodingGzip, nil
+}
+
+func decodePayload(payload []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingIdentity, "":
+		return payload, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unknown payload encoding %q", encoding)
+	}
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Payment is a payment intent taken with a payment provider for an order.
+// IntentID is only unique within its provider.
+//
+// RefundDue is set when the order is cancelled or refunded while the payment
+// is authorised or captured, and cleared once the payment is refunded or
+// released. RefundError holds why the last attempt to refund it failed.
+type Payment struct {
+	ID          int       `db:"id"`
+	OrderID     int       `db:"order_id"`
+	Provider    string    `db:"provider"`
+	IntentID    string    `db:"intent_id"`
+	Amount      int64     `db:"amount"`
+	Currency    string    `db:"currency"`
+	Status      string    `db:"status"`
+	RefundDue   bool      `db:"refund_due"`
+	RefundError string    `db:"refund_error"`
+	Created     time.Time `db:"created"`
+	Updated     time.Time `db:"updated"`
+}
+
+// UpsertPayment inserts payment or, if its intent is already stored, updates
+// the stored status, unless the payment has been settled already. Settled
+// payments never go back to an earlier status. The ID, status and timestamps
+// of payment are set to the stored ones.
+func (db *DB) UpsertPayment(payment *Payment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	query := `
+		INSERT INTO payments (order_id, provider, intent_id, amount, currency, status, created, updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (provider, intent_id) DO UPDATE SET status = excluded.status, updated = excluded.updated
+		WHERE payments.status NOT IN ('succeeded', 'failed', 'refunded', 'cancelled')`
+
+	_, err := db.ExecContext(ctx, query, payment.OrderID, payment.Provider, payment.IntentID, payment.Amount, payment.Currency, payment.Status, now)
+	if err != nil {
+		return err
+	}
+
+	query = `SELECT * FROM payments WHERE provider = $1 AND intent_id = $2`
+
+	return db.GetContext(ctx, payment, query, payment.Provider, payment.IntentID)
+}
+
+func (db *DB) GetPaymentByIntentID(provider, intentID string) (*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var payment Payment
+
+	query := `SELECT * FROM payments WHERE provider = $1 AND intent_id = $2`
+
+	err := db.GetContext(ctx, &payment, query, provider, intentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &payment, err
+}
+
+// GetProviderPayments returns every payment taken with a provider, oldest
+// first.
+func (db *DB) GetProviderPayments(provider string) ([]*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	payments := []*Payment{}
+
+	query := `SELECT * FROM payments WHERE provider = $1 ORDER BY id`
+
+	err := db.SelectContext(ctx, &payments, query, provider)
+	return payments, err
+}
+
+// GetOrderPayments returns the payments taken for an order, oldest first.
+func (db *DB) GetOrderPayments(orderID int) ([]*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	payments := []*Payment{}
+
+	query := `SELECT * FROM payments WHERE order_id = $1 ORDER BY id`
+
+	err := db.SelectContext(ctx, &payments, query, orderID)
+	return payments, err
+}
+
+// GetRefundDuePayments returns the payments taken with a provider that are
+// still to be refunded, oldest first.
+func (db *DB) GetRefundDuePayments(provider string) ([]*Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	payments := []*Payment{}
+
+	query := `SELECT * FROM payments WHERE provider = $1 AND refund_due ORDER BY id`
+
+	err := db.SelectContext(ctx, &payments, query, provider)
+	return payments, err
+}
+
+// UpdatePaymentStatus sets the status of a payment. Payments that are
+// refunded or cancelled no longer have a refund due.
+func (db *DB) UpdatePaymentStatus(id int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE payments SET status = $1, updated = $2,
+			refund_due = refund_due AND $1 NOT IN ('refunded', 'cancelled'),
+			refund_error = CASE WHEN $1 IN ('refunded', 'cancelled') THEN '' ELSE refund_error END
+		WHERE id = $3`
+
+	_, err := db.ExecContext(ctx, query, status, time.Now(), id)
+	return err
+}
+
+// SetPaymentRefundError records why a payment that is due a refund could not
+// be refunded.
+func (db *DB) SetPaymentRefundError(id int, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `UPDATE payments SET refund_error = $1, updated = $2 WHERE id = $3`
+
+	_, err := db.ExecContext(ctx, query, message, time.Now(), id)
+	return err
+}
+
+// InsertPaymentEvent records a webhook event, claiming it for processing. It
+// returns false if the event was recorded already, in which case it must not
+// be processed again.
+func (db *DB) InsertPaymentEvent(provider, eventID, eventType, intentID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO payment_events (provider, event_id, type, intent_id, created)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, event_id) DO NOTHING`
+
+	result, err := db.ExecContext(ctx, query, provider, eventID, eventType, intentID, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// DeletePaymentEvent forgets a webhook event, so that it is processed again
+// when it is redelivered.
+func (db *DB) DeletePaymentEvent(provider, eventID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	query := `DELETE FROM payment_events WHERE provider = $1 AND event_id = $2`
+
+	_, err := db.ExecContext(ctx, query, provider, eventID)
+	return err
+}
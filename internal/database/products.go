@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Variants a product can be sold as.
+const (
+	VariantNormal = "normal"
+	VariantShiny  = "shiny"
+)
+
+// Product is a sellable listing of a Pokémon. Prices are in the minor unit of
+// their currency, e.g. cents for USD. The Pokémon's name is stored alongside
+// its ID so that listings can be shown without going upstream.
+type Product struct {
+	ID          int       `db:"id"`
+	SKU         string    `db:"sku"`
+	PokemonID   int       `db:"pokemon_id"`
+	PokemonName string    `db:"pokemon_name"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Price       int64     `db:"price"`
+	Currency    string    `db:"currency"`
+	Variant     string    `db:"variant"`
+	Level       int       `db:"level"`
+	Active      bool      `db:"active"`
+	Created     time.Time `db:"created"`
+	Updated     time.Time `db:"updated"`
+}
+
+func (db *DB) InsertProduct(product *Product) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	query := `
+		INSERT INTO products (sku, pokemon_id, pokemon_name, name, description, price, currency, variant, level, active, created, updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	result, err := db.ExecContext(ctx, query, product.SKU, product.PokemonID, product.PokemonName, product.Name, product.Description,
+		product.Price, product.Currency, product.Variant, product.Level, product.Active, now, now)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	product.ID = int(id)
+	product.Created = now
+	product.Updated = now
+
+	return nil
+}
+
+func (db *DB) GetProduct(id int) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var product Product
+
+	query := `SELECT * FROM products WHERE id = $1`
+
+	err := db.GetContext(ctx, &product, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &product, err
+}
+
+func (db *DB) GetProductBySKU(sku string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var product Product
+
+	query := `SELECT * FROM products WHERE sku = $1`
+
+	err := db.GetContext(ctx, &product, query, sku)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return &product, err
+}
+
+func (db *DB) UpdateProduct(product *Product) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	query := `
+		UPDATE products
+		SET sku = $1, pokemon_id = $2, pokemon_name = $3, name = $4, description = $5, price = $6,
+			currency = $7, variant = $8, level = $9, active = $10, updated = $11
+		WHERE id = $12`
+
+	_, err := db.ExecContext(ctx, query, product.SKU, product.PokemonID, product.PokemonName, product.Name, product.Description,
+		product.Price, product.Currency, product.Variant, product.Level, product.Active, now, product.ID)
+	if err != nil {
+		return err
+	}
+
+	product.Updated = now
+
+	return nil
+}
+
+// ErrProductOrdered is returned when deleting a product that has been
+// ordered. Such products are deactivated instead, so that their orders can
+// still put them back in stock.
+var ErrProductOrdered = errors.New("product has been ordered")
+
+// DeleteProduct deletes the product with the given ID, along with its stock,
+// reservations and any cart items, reporting whether it existed. Its
+// inventory ledger is kept. Products that have been ordered are not deleted
+// and ErrProductOrdered is returned.
+func (db *DB) DeleteProduct(id int) (bool, error) {
+	var deleted bool
+
+	err := db.Transaction(func(ctx context.Context, tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM products WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		deleted = affected > 0
+
+		var ordered bool
+
+		err = tx.GetContext(ctx, &ordered, `SELECT EXISTS (SELECT 1 FROM order_items WHERE product_id = $1)`, id)
+		if err != nil {
+			return err
+		}
+
+		if ordered {
+			return ErrProductOrdered
+		}
+
+		for _, table := range []string{"inventory", "inventory_reservations", "cart_items"} {
+			_, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE product_id = $1`, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// ProductFilter narrows a ListProducts query. Zero values are not filtered on.
+type ProductFilter struct {
+	PokemonID   int
+	PokemonName string
+	Variant     string
+	Active      *bool
+
+	Offset int
+	Limit  int
+}
+
+// ListProducts returns a page of the products that match filter, ordered by
+// ID, and the total number of matches.
+func (db *DB) ListProducts(filter ProductFilter) ([]*Product, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	var args []any
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"1 = 1"}
+
+	if filter.PokemonID != 0 {
+		where = append(where, "pokemon_id = "+arg(filter.PokemonID))
+	}
+
+	if filter.PokemonName != "" {
+		where = append(where, "pokemon_name = "+arg(filter.PokemonName))
+	}
+
+	if filter.Variant != "" {
+		where = append(where, "variant = "+arg(filter.Variant))
+	}
+
+	if filter.Active != nil {
+		where = append(where, "active = "+arg(*filter.Active))
+	}
+
+	conditions := strings.Join(where, " AND ")
+
+	var count int
+
+	query := `SELECT count(*) FROM products WHERE ` + conditions
+
+	err := db.GetContext(ctx, &count, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	products := []*Product{}
+
+	query = `
+		SELECT * FROM products
+		WHERE ` + conditions + `
+		ORDER BY id
+		LIMIT ` + arg(filter.Limit) + ` OFFSET ` + arg(filter.Offset)
+
+	err = db.SelectContext(ctx, &products, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return products, count, nil
+}
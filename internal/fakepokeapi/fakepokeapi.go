@@ -0,0 +1,215 @@
+package fakepokeapi
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fixtures are stored as captured from pokeapi.co and their links rewritten
+// to the fake server's own address when served.
+const fixtureBaseURL = "https://pokeapi.co/api/v2"
+
+const basePath = "/api/v2"
+
+//go:embed "fixtures"
+var fixtures embed.FS
+
+type resource struct {
+	id      int
+	name    string
+	payload []byte
+}
+
+type handler struct {
+	resources map[string][]resource
+}
+
+// NewHandler returns an http.Handler that answers a read-only subset of the
+// PokeAPI v2 surface from the embedded fixtures. Each directory under fixtures
+// is a resource type, served both as /api/v2/{type}/{name or id} and as a
+// paginated /api/v2/{type} list.
+func NewHandler() (http.Handler, error) {
+	h := &handler{resources: make(map[string][]resource)}
+
+	err := fs.WalkDir(fixtures, "fixtures", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(filePath) != ".json" {
+			return err
+		}
+
+		payload, err := fixtures.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		var identity struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+
+		err = json.Unmarshal(payload, &identity)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", filePath, err)
+		}
+
+		kind := path.Base(path.Dir(filePath))
+		h.resources[kind] = append(h.resources[kind], resource{id: identity.ID, name: identity.Name, payload: payload})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resources := range h.resources {
+		sort.Slice(resources, func(i, j int) bool { return resources[i].id < resources[j].id })
+	}
+
+	return h, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	kind, key, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, basePath), "/"), "/")
+
+	resources, ok := h.resources[kind]
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	baseURL := "http://" + r.Host + basePath
+
+	if key == "" {
+		h.serveList(w, r, baseURL, kind, resources)
+		return
+	}
+
+	for _, res := range resources {
+		if res.name == strings.ToLower(key) || strconv.Itoa(res.id) == key {
+			payload := strings.ReplaceAll(string(res.payload), fixtureBaseURL, baseURL)
+			serveJSON(w, r, []byte(payload))
+			return
+		}
+	}
+
+	http.Error(w, "Not Found", http.StatusNotFound)
+}
+
+func (h *handler) serveList(w http.ResponseWriter, r *http.Request, baseURL, kind string, resources []resource) {
+	offset := queryInt(r, "offset", 0)
+	limit := queryInt(r, "limit", 20)
+	if limit == 0 {
+		limit = 20
+	}
+
+	type result struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+
+	list := struct {
+		Count    int      `json:"count"`
+		Next     *string  `json:"next"`
+		Previous *string  `json:"previous"`
+		Results  []result `json:"results"`
+	}{
+		Count:   len(resources),
+		Results: []result{},
+	}
+
+	for i := offset; i < offset+limit && i < len(resources); i++ {
+		list.Results = append(list.Results, result{
+			Name: resources[i].name,
+			URL:  fmt.Sprintf("%s/%s/%d/", baseURL, kind, resources[i].id),
+		})
+	}
+
+	if offset+limit < len(resources) {
+		next := fmt.Sprintf("%s/%s?offset=%d&limit=%d", baseURL, kind, offset+limit, limit)
+		list.Next = &next
+	}
+
+	if offset > 0 {
+		previousOffset := offset - limit
+		if previousOffset < 0 {
+			previousOffset = 0
+		}
+		previous := fmt.Sprintf("%s/%s?offset=%d&limit=%d", baseURL, kind, previousOffset, limit)
+		list.Previous = &previous
+	}
+
+	payload, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveJSON(w, r, payload)
+}
+
+// serveJSON writes payload with a content derived ETag, answering matching
+// conditional requests with 304 like the real upstream does.
+func serveJSON(w http.ResponseWriter, r *http.Request, payload []byte) {
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(payload)
+}
+
+func queryInt(r *http.Request, key string, defaultValue int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+// Server is a running fake PokeAPI listening on a local loopback address.
+type Server struct {
+	*httptest.Server
+}
+
+// NewServer starts a fake PokeAPI server. The caller should call Close when
+// finished to shut it down.
+func NewServer() *Server {
+	h, err := NewHandler()
+	if err != nil {
+		panic(fmt.Sprintf("fakepokeapi: failed to load fixtures: %v", err))
+	}
+
+	return &Server{httptest.NewServer(h)}
+}
+
+// BaseURL returns the URL to use in place of https://pokeapi.co/api/v2.
+func (s *Server) BaseURL() string {
+	return s.URL + basePath
+}
@@ -0,0 +1,162 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats is a point in time snapshot of a cache's counters and occupancy.
+type Stats struct {
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	Entries    int
+	Bytes      int64
+	MaxEntries int
+	MaxBytes   int64
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache is a concurrency safe least-recently-used cache bounded by entry count
+// and total size. A zero limit means that dimension is unbounded.
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	ll         *list.List
+	items      map[K]*list.Element
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+}
+
+func New[K comparable, V any](maxEntries int, maxBytes int64) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value stored for key. Expired entries are removed and
+// reported as a miss.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+
+	e := element.Value.(*entry[K, V])
+	if !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		c.removeElement(element)
+		c.misses++
+		var zero V
+		return zero, false
+	}
+
+	c.ll.MoveToFront(element)
+	c.hits++
+	return e.value, true
+}
+
+// Add stores value under key, evicting the least recently used entries until
+// the cache is back within its limits. A zero expiresAt never expires. Values
+// larger than the whole cache are not stored, and drop any older value
+// stored under key.
+func (c *Cache[K, V]) Add(key K, value V, size int64, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(key, value, size, expiresAt)
+}
+
+// AddIf is like Add, but only stores value if keep returns true. keep is
+// called with the cache locked, so that it can check for removals that must
+// not be undone without racing them. It reports whether value was stored.
+func (c *Cache[K, V]) AddIf(key K, value V, size int64, expiresAt time.Time, keep func() bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !keep() {
+		return false
+	}
+
+	return c.add(key, value, size, expiresAt)
+}
+
+func (c *Cache[K, V]) add(key K, value V, size int64, expiresAt time.Time) bool {
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return false
+	}
+
+	element := c.ll.PushFront(&entry[K, V]{key: key, value: value, size: size, expiresAt: expiresAt})
+	c.items[key] = element
+	c.bytes += size
+
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+
+	return true
+}
+
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// RemoveFunc removes every entry whose key satisfies match.
+func (c *Cache[K, V]) RemoveFunc(match func(K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.items {
+		if match(key) {
+			c.removeElement(element)
+		}
+	}
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+		Entries:    c.ll.Len(),
+		Bytes:      c.bytes,
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+	}
+}
+
+func (c *Cache[K, V]) removeElement(element *list.Element) {
+	e := c.ll.Remove(element).(*entry[K, V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
@@ -0,0 +1,37 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddTooLargeDropsOlderValue(t *testing.T) {
+	c := New[string, string](0, 10)
+
+	c.Add("pikachu", "old", 5, time.Time{})
+	c.Add("pikachu", "new", 11, time.Time{})
+
+	if value, ok := c.Get("pikachu"); ok {
+		t.Errorf("got %q after adding a value larger than the cache; want nothing", value)
+	}
+
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("got %d entries of %d bytes; want none", stats.Entries, stats.Bytes)
+	}
+}
+
+func TestAddIf(t *testing.T) {
+	c := New[string, string](0, 0)
+
+	if !c.AddIf("pikachu", "kept", 1, time.Time{}, func() bool { return true }) {
+		t.Errorf("AddIf did not store a value it was told to keep")
+	}
+
+	if c.AddIf("pikachu", "dropped", 1, time.Time{}, func() bool { return false }) {
+		t.Errorf("AddIf stored a value it was told not to keep")
+	}
+
+	if value, _ := c.Get("pikachu"); value != "kept" {
+		t.Errorf("got %q; want %q", value, "kept")
+	}
+}
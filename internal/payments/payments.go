@@ -0,0 +1,83 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Intent statuses. An intent is created once the customer has authorised the
+// payment and waits for the store to capture it. Refunding an intent that was
+// never captured cancels it instead.
+const (
+	StatusRequiresCapture = "requires_capture"
+	StatusSucceeded       = "succeeded"
+	StatusFailed          = "failed"
+	StatusRefunded        = "refunded"
+	StatusCancelled       = "cancelled"
+)
+
+// Webhook event types.
+const (
+	EventAuthorized = "payment.authorized"
+	EventSucceeded  = "payment.succeeded"
+	EventFailed     = "payment.failed"
+	EventRefunded   = "payment.refunded"
+)
+
+var (
+	ErrIntentNotFound   = errors.New("payments: intent not found")
+	ErrInvalidStatus    = errors.New("payments: intent is not in a status that allows this")
+	ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+	ErrInvalidEvent     = errors.New("payments: invalid webhook event")
+)
+
+// Intent is a payment of an amount in minor units, such as cents. Reference
+// identifies what is being paid for, e.g. "order:42", and ClientSecret lets
+// the customer's browser complete the payment with the provider.
+type Intent struct {
+	ID           string
+	Reference    string
+	Amount       int64
+	Currency     string
+	Status       string
+	ClientSecret string
+}
+
+// Event is a webhook notification about an intent. Providers may deliver
+// the same event more than once, so ID should be used to process it only
+// once.
+type Event struct {
+	ID       string
+	Type     string
+	IntentID string
+}
+
+// Provider is a payment service provider.
+type Provider interface {
+	// Name identifies the provider. Intent and event IDs are only unique
+	// within a provider.
+	Name() string
+
+	// CreateIntent starts a payment for reference. Calling it again for a
+	// reference whose intent has not failed or been cancelled returns the
+	// same intent.
+	CreateIntent(ctx context.Context, reference string, amount int64, currency string) (*Intent, error)
+
+	// GetIntent returns the intent with the given ID as the provider has it
+	// now. Webhook events only say that something happened to an intent, so
+	// its status should be confirmed with GetIntent before acting on them.
+	GetIntent(ctx context.Context, intentID string) (*Intent, error)
+
+	// Capture collects an authorised payment.
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+
+	// Refund pays a captured payment back in full, or cancels an authorised
+	// payment that has not been captured.
+	Refund(ctx context.Context, intentID string) (*Intent, error)
+
+	// VerifyWebhook checks the signature of a webhook request and returns the
+	// event it carries. It returns ErrInvalidSignature if the request did not
+	// come from the provider, and ErrInvalidEvent if the event is malformed.
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
@@ -0,0 +1,243 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SimulatorSignatureHeader carries the signature of simulated webhooks, in
+// the form "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">".
+const SimulatorSignatureHeader = "Simulator-Signature"
+
+// simulatorTolerance is how old a webhook signature may be before it is
+// rejected, to stop old deliveries from being replayed.
+const simulatorTolerance = 5 * time.Minute
+
+// Simulator is a Provider that runs in memory without any network access, so
+// that payments can be taken offline and in tests. Every intent it creates is
+// authorised straight away, and its intent IDs are derived from the secret
+// and the reference they are for. Intents only live as long as the
+// simulator, so ones that were stored elsewhere should be put back with
+// Restore when it is created.
+//
+// Simulated webhooks are built with Webhook and can be posted to the store's
+// webhook endpoint like ones from a real provider.
+type Simulator struct {
+	secret []byte
+
+	mu         sync.Mutex
+	intents    map[string]*Intent
+	references map[string]string
+	attempts   map[string]int
+}
+
+func NewSimulator(secret string) *Simulator {
+	return &Simulator{
+		secret:     []byte(secret),
+		intents:    map[string]*Intent{},
+		references: map[string]string{},
+		attempts:   map[string]int{},
+	}
+}
+
+func (s *Simulator) Name() string {
+	return "simulator"
+}
+
+func (s *Simulator) mac(parts ...string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Simulator) CreateIntent(ctx context.Context, reference string, amount int64, currency string) (*Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.references[reference]; ok {
+		intent := s.intents[id]
+		if intent.Status != StatusFailed && intent.Status != StatusCancelled {
+			result := *intent
+			return &result, nil
+		}
+	}
+
+	// Every attempt at paying for a reference gets an intent ID of its own
+	var id string
+
+	for {
+		s.attempts[reference]++
+
+		id = "sim_pi_" + s.mac("intent", reference, strconv.Itoa(s.attempts[reference]))[:24]
+		if _, ok := s.intents[id]; !ok {
+			break
+		}
+	}
+
+	intent := &Intent{
+		ID:           id,
+		Reference:    reference,
+		Amount:       amount,
+		Currency:     currency,
+		Status:       StatusRequiresCapture,
+		ClientSecret: s.clientSecret(id),
+	}
+
+	s.intents[id] = intent
+	s.references[reference] = id
+
+	result := *intent
+	return &result, nil
+}
+
+func (s *Simulator) clientSecret(intentID string) string {
+	return intentID + "_secret_" + s.mac("secret", intentID)[:16]
+}
+
+// Restore puts intents the simulator created before back in memory, such as
+// ones that were stored before a restart, so that they can still be captured
+// and refunded and their IDs are not handed out again. Intents should be
+// restored in the order they were created.
+func (s *Simulator) Restore(intents ...Intent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, intent := range intents {
+		intent := intent
+		intent.ClientSecret = s.clientSecret(intent.ID)
+
+		s.intents[intent.ID] = &intent
+		s.references[intent.Reference] = intent.ID
+		s.attempts[intent.Reference]++
+	}
+}
+
+func (s *Simulator) GetIntent(ctx context.Context, intentID string) (*Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+
+	result := *intent
+	return &result, nil
+}
+
+// transition moves the intent with the given ID from one of the statuses
+// in from to status to.
+func (s *Simulator) transition(intentID string, to string, from ...string) (*Intent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+
+	for _, status := range from {
+		if intent.Status == status {
+			intent.Status = to
+
+			result := *intent
+			return &result, nil
+		}
+	}
+
+	return nil, ErrInvalidStatus
+}
+
+func (s *Simulator) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	return s.transition(intentID, StatusSucceeded, StatusRequiresCapture)
+}
+
+func (s *Simulator) Refund(ctx context.Context, intentID string) (*Intent, error) {
+	intent, err := s.transition(intentID, StatusCancelled, StatusRequiresCapture)
+	if errors.Is(err, ErrInvalidStatus) {
+		return s.transition(intentID, StatusRefunded, StatusSucceeded)
+	}
+
+	return intent, err
+}
+
+// Webhook returns the payload and headers of a signed webhook notifying that
+// eventType happened to the intent with the given ID. Every call makes a new
+// event with an ID of its own, so a redelivery is simulated by posting the
+// same payload and headers again.
+func (s *Simulator) Webhook(eventType, intentID string) ([]byte, http.Header, error) {
+	nonce := make([]byte, 12)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	event := Event{
+		ID:       "sim_evt_" + hex.EncodeToString(nonce),
+		Type:     eventType,
+		IntentID: intentID,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set(SimulatorSignatureHeader, fmt.Sprintf("t=%s,v1=%s", timestamp, s.mac(timestamp+"."+string(payload))))
+
+	return payload, header, nil
+}
+
+func (s *Simulator) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	var timestamp, signature string
+
+	for _, part := range strings.Split(header.Get(SimulatorSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	age := time.Since(time.Unix(unix, 0))
+	if age > simulatorTolerance || age < -simulatorTolerance {
+		return nil, ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.mac(timestamp+"."+string(payload)))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+
+	err = json.Unmarshal(payload, &event)
+	if err != nil || event.ID == "" || event.Type == "" || event.IntentID == "" {
+		return nil, ErrInvalidEvent
+	}
+
+	return &event, nil
+}
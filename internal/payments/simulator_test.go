@@ -0,0 +1,236 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSimulatorVerifyWebhook(t *testing.T) {
+	s := NewSimulator("test-secret")
+
+	payload, header, err := s.Webhook(EventAuthorized, "sim_pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := s.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatalf("valid webhook: got error %v", err)
+	}
+
+	if event.Type != EventAuthorized || event.IntentID != "sim_pi_1" || event.ID == "" {
+		t.Errorf("valid webhook: got event %+v", event)
+	}
+
+	// signed returns headers signing payload as of the given time
+	signed := func(s *Simulator, payload string, at time.Time) http.Header {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+
+		header := make(http.Header)
+		header.Set(SimulatorSignatureHeader, fmt.Sprintf("t=%s,v1=%s", timestamp, s.mac(timestamp+"."+payload)))
+		return header
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		header  http.Header
+		want    error
+	}{
+		{
+			name:    "tampered payload",
+			payload: string(payload) + " ",
+			header:  header,
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "other secret",
+			payload: string(payload),
+			header:  signed(NewSimulator("other-secret"), string(payload), time.Now()),
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "no signature",
+			payload: string(payload),
+			header:  make(http.Header),
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "expired timestamp",
+			payload: string(payload),
+			header:  signed(s, string(payload), time.Now().Add(-simulatorTolerance-time.Minute)),
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "future timestamp",
+			payload: string(payload),
+			header:  signed(s, string(payload), time.Now().Add(simulatorTolerance+time.Minute)),
+			want:    ErrInvalidSignature,
+		},
+		{
+			name:    "malformed event",
+			payload: `{"ID":"sim_evt_1"}`,
+			header:  signed(s, `{"ID":"sim_evt_1"}`, time.Now()),
+			want:    ErrInvalidEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.VerifyWebhook([]byte(tt.payload), tt.header)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulatorWebhookEventIDs(t *testing.T) {
+	s := NewSimulator("test-secret")
+
+	first, _, err := s.Webhook(EventAuthorized, "sim_pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _, err := s.Webhook(EventAuthorized, "sim_pi_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first) == string(second) {
+		t.Errorf("two events for the same intent got the same payload %s", first)
+	}
+}
+
+func TestSimulatorTransitions(t *testing.T) {
+	ctx := context.Background()
+	s := NewSimulator("test-secret")
+
+	intent, err := s.CreateIntent(ctx, "order:1", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if intent.Status != StatusRequiresCapture {
+		t.Fatalf("created intent has status %q; want %q", intent.Status, StatusRequiresCapture)
+	}
+
+	again, err := s.CreateIntent(ctx, "order:1", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.ID != intent.ID {
+		t.Errorf("second intent for the same reference has ID %q; want %q", again.ID, intent.ID)
+	}
+
+	steps := []struct {
+		name   string
+		action func(context.Context, string) (*Intent, error)
+		status string
+		err    error
+	}{
+		{name: "capture", action: s.Capture, status: StatusSucceeded},
+		{name: "capture again", action: s.Capture, err: ErrInvalidStatus},
+		{name: "refund", action: s.Refund, status: StatusRefunded},
+		{name: "refund again", action: s.Refund, err: ErrInvalidStatus},
+	}
+
+	for _, step := range steps {
+		got, err := step.action(ctx, intent.ID)
+
+		switch {
+		case step.err != nil && !errors.Is(err, step.err):
+			t.Fatalf("%s: got error %v; want %v", step.name, err, step.err)
+		case step.err == nil && err != nil:
+			t.Fatalf("%s: got error %v", step.name, err)
+		case step.err == nil && got.Status != step.status:
+			t.Fatalf("%s: got status %q; want %q", step.name, got.Status, step.status)
+		}
+	}
+
+	uncaptured, err := s.CreateIntent(ctx, "order:2", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := s.Refund(ctx, uncaptured.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cancelled.Status != StatusCancelled {
+		t.Errorf("refunding an uncaptured intent gave status %q; want %q", cancelled.Status, StatusCancelled)
+	}
+
+	_, err = s.Capture(ctx, uncaptured.ID)
+	if !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("capturing a cancelled intent: got error %v; want %v", err, ErrInvalidStatus)
+	}
+
+	retry, err := s.CreateIntent(ctx, "order:2", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retry.ID == uncaptured.ID || retry.Status != StatusRequiresCapture {
+		t.Errorf("paying again after a cancellation gave %+v; want a new intent", retry)
+	}
+
+	_, err = s.Capture(ctx, "sim_pi_unknown")
+	if !errors.Is(err, ErrIntentNotFound) {
+		t.Errorf("capturing an unknown intent: got error %v; want %v", err, ErrIntentNotFound)
+	}
+}
+
+func TestSimulatorRestore(t *testing.T) {
+	ctx := context.Background()
+	before := NewSimulator("test-secret")
+
+	captured, err := before.CreateIntent(ctx, "order:1", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captured, err = before.Capture(ctx, captured.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := before.CreateIntent(ctx, "order:2", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err = before.Refund(ctx, cancelled.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := NewSimulator("test-secret")
+	after.Restore(*captured, *cancelled)
+
+	refunded, err := after.Refund(ctx, captured.ID)
+	if err != nil {
+		t.Fatalf("refunding a restored intent: got error %v", err)
+	}
+
+	if refunded.Status != StatusRefunded {
+		t.Errorf("refunding a restored intent gave status %q; want %q", refunded.Status, StatusRefunded)
+	}
+
+	retry, err := after.CreateIntent(ctx, "order:2", 1000, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retry.ID == cancelled.ID {
+		t.Errorf("paying again after a restore reused intent ID %q", retry.ID)
+	}
+}
@@ -0,0 +1,25 @@
+package pokemon
+
+// lastSpeciesOfGeneration holds the highest National Pokédex number introduced
+// in each generation, starting with generation I.
+var lastSpeciesOfGeneration = [...]int{151, 251, 386, 493, 649, 721, 809, 905, 1025}
+
+// MaxGeneration is the latest generation this package knows about.
+const MaxGeneration = len(lastSpeciesOfGeneration)
+
+// Generation returns the generation a species was introduced in from its
+// National Pokédex number, or 0 if it is unknown. Alternate forms share the
+// number of their species.
+func Generation(speciesID int) int {
+	if speciesID < 1 {
+		return 0
+	}
+
+	for i, last := range lastSpeciesOfGeneration {
+		if speciesID <= last {
+			return i + 1
+		}
+	}
+
+	return 0
+}
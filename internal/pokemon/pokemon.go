@@ -1,15 +1,29 @@
 package pokemon
 
 import (
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
-	"github.com/amirulabu/pokemon-store-backend/internal/database"
 )
 
+// Client reads Pokémon data from the upstream PokeAPI through the response
+// cache, rewriting upstream links to point at the store.
+type Client struct {
+	cache           *cached_http.Cache
+	upstreamBaseURL string
+	storeBaseURL    string
+}
+
+func NewClient(cache *cached_http.Cache, upstreamBaseURL, storeBaseURL string) *Client {
+	return &Client{
+		cache:           cache,
+		upstreamBaseURL: strings.TrimSuffix(upstreamBaseURL, "/"),
+		storeBaseURL:    strings.TrimSuffix(storeBaseURL, "/"),
+	}
+}
+
 type SinglePokemon struct {
 	Abilities []struct {
 		Ability struct {
@@ -254,21 +268,20 @@ type SinglePokemon struct {
 	Weight int `json:"weight"`
 }
 
-func GetSinglePokemon(nameOrId string, db *database.DB) (SinglePokemon, error) {
-	url := fmt.Sprintf("https://pokeapi.co/api/v2/pokemon/%s", nameOrId)
+// SinglePokemonURL returns the upstream URL GetSinglePokemon reads from.
+func (c *Client) SinglePokemonURL(nameOrId string) string {
+	return fmt.Sprintf("%s/pokemon/%s", c.upstreamBaseURL, nameOrId)
+}
 
-	res, err := cached_http.CacheAndRetrieve(url, db)
-	if err != nil {
-		return SinglePokemon{}, err
-	}
+func (c *Client) GetSinglePokemon(nameOrId string) (SinglePokemon, cached_http.Info, error) {
+	url := c.SinglePokemonURL(nameOrId)
 
-	var data SinglePokemon
-	err = json.Unmarshal(res, &data)
+	data, info, err := cached_http.RetrieveJSON[SinglePokemon](c.cache, url)
 	if err != nil {
-		return SinglePokemon{}, err
+		return SinglePokemon{}, cached_http.Info{}, err
 	}
 
-	return data, nil
+	return data, info, nil
 }
 
 type Results struct {
@@ -283,42 +296,45 @@ type PokemonList struct {
 	Results  []Results   `json:"results"`
 }
 
-func replacePokeAPIURLWithStoreUrl(url string, baseUrl string) string {
-	newUrl := baseUrl + "/pokemon" // fmt.Sprintf("%s/pokemon", baseUrl)
-	result := strings.Replace(url, "https://pokeapi.co/api/v2/pokemon", newUrl, 1)
+func (c *Client) replacePokeAPIURLWithStoreUrl(url string) string {
+	newUrl := c.storeBaseURL + "/pokemon"
+	result := strings.Replace(url, c.upstreamBaseURL+"/pokemon", newUrl, 1)
 	re := regexp.MustCompile(`\/$`)
 	result = re.ReplaceAllString(result, "")
 	return result
 }
 
-func GetPokemons(offset int, limit int, baseUrl string, db *database.DB) (PokemonList, error) {
-	url := fmt.Sprintf("https://pokeapi.co/api/v2/pokemon?offset=%d&limit=%d", offset, limit)
-	res, err := cached_http.CacheAndRetrieve(url, db)
-
-	if err != nil {
-		return PokemonList{}, err
-	}
+// StoreURL returns the store's own URL for path, as used in place of
+// upstream links.
+func (c *Client) StoreURL(path string) string {
+	return c.storeBaseURL + path
+}
 
-	var data PokemonList
+// PokemonsURL returns the upstream URL GetPokemons reads from.
+func (c *Client) PokemonsURL(offset int, limit int) string {
+	return fmt.Sprintf("%s/pokemon?offset=%d&limit=%d", c.upstreamBaseURL, offset, limit)
+}
 
-	err = json.Unmarshal(res, &data)
+func (c *Client) GetPokemons(offset int, limit int) (PokemonList, cached_http.Info, error) {
+	url := c.PokemonsURL(offset, limit)
+	data, info, err := cached_http.RetrieveJSON[PokemonList](c.cache, url)
 	if err != nil {
-		return PokemonList{}, err
+		return PokemonList{}, cached_http.Info{}, err
 	}
 
 	newResults := make([]Results, len(data.Results))
 	if data.Next != nil {
-		data.Next = replacePokeAPIURLWithStoreUrl(data.Next.(string), baseUrl)
+		data.Next = c.replacePokeAPIURLWithStoreUrl(data.Next.(string))
 	}
 	if data.Previous != nil {
-		data.Previous = replacePokeAPIURLWithStoreUrl(data.Previous.(string), baseUrl)
+		data.Previous = c.replacePokeAPIURLWithStoreUrl(data.Previous.(string))
 	}
 	for i, element := range data.Results {
 		newResults[i].Name = element.Name
-		newResults[i].URL = replacePokeAPIURLWithStoreUrl(element.URL, baseUrl)
+		newResults[i].URL = c.replacePokeAPIURLWithStoreUrl(element.URL)
 	}
 
 	data.Results = newResults
 
-	return data, nil
+	return data, info, nil
 }
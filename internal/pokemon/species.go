@@ -0,0 +1,120 @@
+package pokemon
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+)
+
+type NamedResource struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type Species struct {
+	BaseHappiness  int             `json:"base_happiness"`
+	CaptureRate    int             `json:"capture_rate"`
+	Color          NamedResource   `json:"color"`
+	EggGroups      []NamedResource `json:"egg_groups"`
+	EvolutionChain struct {
+		URL string `json:"url"`
+	} `json:"evolution_chain"`
+	EvolvesFromSpecies *NamedResource `json:"evolves_from_species"`
+	FlavorTextEntries  []struct {
+		FlavorText string        `json:"flavor_text"`
+		Language   NamedResource `json:"language"`
+		Version    NamedResource `json:"version"`
+	} `json:"flavor_text_entries"`
+	GenderRate int `json:"gender_rate"`
+	Genera     []struct {
+		Genus    string        `json:"genus"`
+		Language NamedResource `json:"language"`
+	} `json:"genera"`
+	Generation   NamedResource  `json:"generation"`
+	GrowthRate   NamedResource  `json:"growth_rate"`
+	Habitat      *NamedResource `json:"habitat"`
+	HatchCounter int            `json:"hatch_counter"`
+	ID           int            `json:"id"`
+	IsBaby       bool           `json:"is_baby"`
+	IsLegendary  bool           `json:"is_legendary"`
+	IsMythical   bool           `json:"is_mythical"`
+	Name         string         `json:"name"`
+	Order        int            `json:"order"`
+	Varieties    []struct {
+		IsDefault bool          `json:"is_default"`
+		Pokemon   NamedResource `json:"pokemon"`
+	} `json:"varieties"`
+}
+
+type EvolutionChain struct {
+	BabyTriggerItem *NamedResource `json:"baby_trigger_item"`
+	Chain           ChainLink      `json:"chain"`
+	ID              int            `json:"id"`
+}
+
+type ChainLink struct {
+	EvolutionDetails []EvolutionDetail `json:"evolution_details"`
+	EvolvesTo        []ChainLink       `json:"evolves_to"`
+	IsBaby           bool              `json:"is_baby"`
+	Species          NamedResource     `json:"species"`
+}
+
+type EvolutionDetail struct {
+	Gender                *int           `json:"gender"`
+	HeldItem              *NamedResource `json:"held_item"`
+	Item                  *NamedResource `json:"item"`
+	KnownMove             *NamedResource `json:"known_move"`
+	KnownMoveType         *NamedResource `json:"known_move_type"`
+	Location              *NamedResource `json:"location"`
+	MinAffection          *int           `json:"min_affection"`
+	MinBeauty             *int           `json:"min_beauty"`
+	MinHappiness          *int           `json:"min_happiness"`
+	MinLevel              *int           `json:"min_level"`
+	NeedsOverworldRain    bool           `json:"needs_overworld_rain"`
+	PartySpecies          *NamedResource `json:"party_species"`
+	PartyType             *NamedResource `json:"party_type"`
+	RelativePhysicalStats *int           `json:"relative_physical_stats"`
+	TimeOfDay             string         `json:"time_of_day"`
+	TradeSpecies          *NamedResource `json:"trade_species"`
+	Trigger               NamedResource  `json:"trigger"`
+	TurnUpsideDown        bool           `json:"turn_upside_down"`
+}
+
+// resourceKey returns the name or ID at the end of a PokeAPI resource URL,
+// so that resources reached through links share cache entries with the ones
+// requested directly.
+func resourceKey(url string) string {
+	return path.Base(strings.TrimSuffix(url, "/"))
+}
+
+// ResourceID returns the numeric ID at the end of a PokeAPI resource URL, or
+// zero if there is none.
+func ResourceID(url string) int {
+	id, _ := strconv.Atoi(resourceKey(url))
+	return id
+}
+
+func (c *Client) SpeciesURL(nameOrId string) string {
+	return fmt.Sprintf("%s/pokemon-species/%s", c.upstreamBaseURL, nameOrId)
+}
+
+func (c *Client) GetSpecies(nameOrId string) (Species, cached_http.Info, error) {
+	return cached_http.RetrieveJSON[Species](c.cache, c.SpeciesURL(nameOrId))
+}
+
+// GetSpeciesOf returns the species a Pokémon belongs to.
+func (c *Client) GetSpeciesOf(p SinglePokemon) (Species, cached_http.Info, error) {
+	return c.GetSpecies(resourceKey(p.Species.URL))
+}
+
+func (c *Client) EvolutionChainURL(id string) string {
+	return fmt.Sprintf("%s/evolution-chain/%s", c.upstreamBaseURL, id)
+}
+
+// GetEvolutionChainOf returns the evolution chain a species is part of.
+func (c *Client) GetEvolutionChainOf(species Species) (EvolutionChain, cached_http.Info, error) {
+	return cached_http.RetrieveJSON[EvolutionChain](c.cache, c.EvolutionChainURL(resourceKey(species.EvolutionChain.URL)))
+}
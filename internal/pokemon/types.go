@@ -0,0 +1,178 @@
+package pokemon
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/amirulabu/pokemon-store-backend/internal/cached_http"
+)
+
+type Type struct {
+	DamageRelations struct {
+		DoubleDamageFrom []NamedResource `json:"double_damage_from"`
+		DoubleDamageTo   []NamedResource `json:"double_damage_to"`
+		HalfDamageFrom   []NamedResource `json:"half_damage_from"`
+		HalfDamageTo     []NamedResource `json:"half_damage_to"`
+		NoDamageFrom     []NamedResource `json:"no_damage_from"`
+		NoDamageTo       []NamedResource `json:"no_damage_to"`
+	} `json:"damage_relations"`
+	Generation      NamedResource  `json:"generation"`
+	ID              int            `json:"id"`
+	MoveDamageClass *NamedResource `json:"move_damage_class"`
+	Name            string         `json:"name"`
+	Pokemon         []struct {
+		Pokemon NamedResource `json:"pokemon"`
+		Slot    int           `json:"slot"`
+	} `json:"pokemon"`
+}
+
+type NamedResourceList struct {
+	Count    int             `json:"count"`
+	Next     *string         `json:"next"`
+	Previous *string         `json:"previous"`
+	Results  []NamedResource `json:"results"`
+}
+
+func (c *Client) TypeURL(name string) string {
+	return fmt.Sprintf("%s/type/%s", c.upstreamBaseURL, name)
+}
+
+func (c *Client) GetType(name string) (Type, cached_http.Info, error) {
+	return cached_http.RetrieveJSON[Type](c.cache, c.TypeURL(name))
+}
+
+// GetTypes returns every type that takes part in battles, ordered by ID.
+// PokeAPI also lists the "unknown" and "shadow" types, with IDs above 10000
+// and no damage relations, which are left out.
+func (c *Client) GetTypes() ([]Type, cached_http.Info, error) {
+	list, listInfo, err := cached_http.RetrieveJSON[NamedResourceList](c.cache, c.upstreamBaseURL+"/type?offset=0&limit=100")
+	if err != nil {
+		return nil, cached_http.Info{}, err
+	}
+
+	infos := []cached_http.Info{listInfo}
+	types := []Type{}
+
+	for _, result := range list.Results {
+		id := ResourceID(result.URL)
+		if id == 0 || id > 10000 {
+			continue
+		}
+
+		t, info, err := c.GetType(result.Name)
+		if err != nil {
+			return nil, cached_http.Info{}, err
+		}
+
+		infos = append(infos, info)
+		types = append(types, t)
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i].ID < types[j].ID })
+
+	return types, cached_http.MergeInfo(infos...), nil
+}
+
+// TypeChart holds the damage multiplier of every attacking type against every
+// defending type. Pairs that are not listed deal normal (1x) damage.
+type TypeChart map[string]map[string]float64
+
+func NewTypeChart(types []Type) TypeChart {
+	chart := make(TypeChart, len(types))
+
+	for _, attacking := range types {
+		row := make(map[string]float64, len(types))
+
+		for _, defending := range types {
+			row[defending.Name] = 1
+		}
+
+		for _, defending := range attacking.DamageRelations.DoubleDamageTo {
+			row[defending.Name] = 2
+		}
+		for _, defending := range attacking.DamageRelations.HalfDamageTo {
+			row[defending.Name] = 0.5
+		}
+		for _, defending := range attacking.DamageRelations.NoDamageTo {
+			row[defending.Name] = 0
+		}
+
+		chart[attacking.Name] = row
+	}
+
+	return chart
+}
+
+// Multiplier returns the damage multiplier of an attack of the given type
+// against a Pokémon with the defending types, e.g. 4 for ice against a
+// grass/flying Pokémon.
+func (chart TypeChart) Multiplier(attacking string, defending []string) float64 {
+	multiplier := 1.0
+
+	for _, d := range defending {
+		if m, ok := chart[attacking][d]; ok {
+			multiplier *= m
+		}
+	}
+
+	return multiplier
+}
+
+// Defense returns the multiplier of attacks of every type against a Pokémon
+// with the defending types.
+func (chart TypeChart) Defense(defending []string) map[string]float64 {
+	multipliers := make(map[string]float64, len(chart))
+
+	for attacking := range chart {
+		multipliers[attacking] = chart.Multiplier(attacking, defending)
+	}
+
+	return multipliers
+}
+
+type TypeV1 struct {
+	ID          int
+	Name        string
+	URL         string
+	Generation  int
+	DamageClass string
+}
+
+// TypeDetailV1 adds the multipliers of the type attacking and being attacked
+// by every other type, and the Pokémon that have it.
+type TypeDetailV1 struct {
+	TypeV1
+	Attack  map[string]float64
+	Defense map[string]float64
+	Pokemon []SpeciesRefV1
+}
+
+func (c *Client) NewTypeV1(t Type) TypeV1 {
+	v := TypeV1{
+		ID:         t.ID,
+		Name:       t.Name,
+		URL:        c.StoreURL("/types/" + t.Name),
+		Generation: ResourceID(t.Generation.URL),
+	}
+
+	if t.MoveDamageClass != nil {
+		v.DamageClass = t.MoveDamageClass.Name
+	}
+
+	return v
+}
+
+func (c *Client) NewTypeDetailV1(t Type, chart TypeChart) TypeDetailV1 {
+	v := TypeDetailV1{
+		TypeV1:  c.NewTypeV1(t),
+		Attack:  chart[t.Name],
+		Defense: chart.Defense([]string{t.Name}),
+		Pokemon: make([]SpeciesRefV1, 0, len(t.Pokemon)),
+	}
+
+	for _, p := range t.Pokemon {
+		v.Pokemon = append(v.Pokemon, c.pokemonRef(p.Pokemon))
+	}
+
+	return v
+}
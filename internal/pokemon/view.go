@@ -0,0 +1,273 @@
+package pokemon
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Views of a single Pokémon that the store serves. ViewV1 is the store's own
+// stable representation, ViewRaw the upstream SinglePokemon as is.
+const (
+	ViewV1  = "v1"
+	ViewRaw = "raw"
+)
+
+// PokemonV1 is a compact, store-facing representation of a SinglePokemon that
+// does not change shape when PokeAPI does. New fields may be added, but
+// anything incompatible belongs in a new version.
+type PokemonV1 struct {
+	ID        int
+	Name      string
+	Types     []string
+	Stats     map[string]int
+	Abilities []AbilityV1
+	Sprites   SpritesV1
+	HeightM   float64
+	WeightKg  float64
+}
+
+type AbilityV1 struct {
+	Name     string
+	IsHidden bool
+}
+
+type SpritesV1 struct {
+	Default      string
+	Shiny        string
+	Artwork      string
+	ArtworkShiny string
+}
+
+// StatKey converts a PokeAPI stat name such as "special-attack" to the key
+// used for it by the store, "special_attack".
+func StatKey(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// NewPokemonV1 converts p to the v1 representation. PokeAPI heights are in
+// decimetres and weights in hectograms.
+func NewPokemonV1(p SinglePokemon) PokemonV1 {
+	v := PokemonV1{
+		ID:        p.ID,
+		Name:      p.Name,
+		Types:     make([]string, 0, len(p.Types)),
+		Stats:     make(map[string]int, len(p.Stats)),
+		Abilities: make([]AbilityV1, 0, len(p.Abilities)),
+		Sprites: SpritesV1{
+			Default:      p.Sprites.FrontDefault,
+			Shiny:        p.Sprites.FrontShiny,
+			Artwork:      p.Sprites.Other.OfficialArtwork.FrontDefault,
+			ArtworkShiny: p.Sprites.Other.OfficialArtwork.FrontShiny,
+		},
+		HeightM:  float64(p.Height) / 10,
+		WeightKg: float64(p.Weight) / 10,
+	}
+
+	// Sort copies, p may share its slices with the in-memory cache
+	types := append(p.Types[:0:0], p.Types...)
+	sort.SliceStable(types, func(i, j int) bool { return types[i].Slot < types[j].Slot })
+	for _, t := range types {
+		v.Types = append(v.Types, t.Type.Name)
+	}
+
+	for _, s := range p.Stats {
+		v.Stats[StatKey(s.Stat.Name)] = s.BaseStat
+	}
+
+	abilities := append(p.Abilities[:0:0], p.Abilities...)
+	sort.SliceStable(abilities, func(i, j int) bool { return abilities[i].Slot < abilities[j].Slot })
+	for _, a := range abilities {
+		v.Abilities = append(v.Abilities, AbilityV1{Name: a.Ability.Name, IsHidden: a.IsHidden})
+	}
+
+	return v
+}
+
+// PokemonV1Fields maps the names accepted in ?fields= to the PokemonV1 field
+// each selects.
+var PokemonV1Fields = map[string]string{
+	"id":        "ID",
+	"name":      "Name",
+	"types":     "Types",
+	"stats":     "Stats",
+	"abilities": "Abilities",
+	"sprites":   "Sprites",
+	"height_m":  "HeightM",
+	"weight_kg": "WeightKg",
+}
+
+// Select returns only the given fields of v, named as in PokemonV1Fields,
+// keyed as they would be when v is encoded whole.
+func (v PokemonV1) Select(fields []string) map[string]any {
+	values := map[string]any{
+		"id":        v.ID,
+		"name":      v.Name,
+		"types":     v.Types,
+		"stats":     v.Stats,
+		"abilities": v.Abilities,
+		"sprites":   v.Sprites,
+		"height_m":  v.HeightM,
+		"weight_kg": v.WeightKg,
+	}
+
+	selected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if key, ok := PokemonV1Fields[field]; ok {
+			selected[key] = values[field]
+		}
+	}
+
+	return selected
+}
+
+type SpeciesV1 struct {
+	ID            int
+	Name          string
+	Genus         string
+	Generation    int
+	Color         string
+	Habitat       string
+	FlavorText    string
+	CaptureRate   int
+	BaseHappiness int
+	IsBaby        bool
+	IsLegendary   bool
+	IsMythical    bool
+	EvolvesFrom   *SpeciesRefV1
+	Varieties     []SpeciesRefV1
+}
+
+// SpeciesRefV1 links to a Pokémon on the store by name and URL. Species link
+// to their default variety, which shares their ID.
+type SpeciesRefV1 struct {
+	Name string
+	URL  string
+}
+
+func (c *Client) pokemonRef(resource NamedResource) SpeciesRefV1 {
+	return SpeciesRefV1{
+		Name: resource.Name,
+		URL:  c.StoreURL(fmt.Sprintf("/pokemon/%d", ResourceID(resource.URL))),
+	}
+}
+
+// NewSpeciesV1 converts s to the v1 representation, using the English genus
+// and the most recent English flavor text.
+func (c *Client) NewSpeciesV1(s Species) SpeciesV1 {
+	v := SpeciesV1{
+		ID:            s.ID,
+		Name:          s.Name,
+		Generation:    ResourceID(s.Generation.URL),
+		Color:         s.Color.Name,
+		CaptureRate:   s.CaptureRate,
+		BaseHappiness: s.BaseHappiness,
+		IsBaby:        s.IsBaby,
+		IsLegendary:   s.IsLegendary,
+		IsMythical:    s.IsMythical,
+		Varieties:     make([]SpeciesRefV1, 0, len(s.Varieties)),
+	}
+
+	if s.Habitat != nil {
+		v.Habitat = s.Habitat.Name
+	}
+
+	for _, genus := range s.Genera {
+		if genus.Language.Name == "en" {
+			v.Genus = genus.Genus
+		}
+	}
+
+	for _, entry := range s.FlavorTextEntries {
+		if entry.Language.Name == "en" {
+			v.FlavorText = strings.Join(strings.Fields(entry.FlavorText), " ")
+		}
+	}
+
+	if s.EvolvesFromSpecies != nil {
+		ref := c.pokemonRef(*s.EvolvesFromSpecies)
+		v.EvolvesFrom = &ref
+	}
+
+	for _, variety := range s.Varieties {
+		v.Varieties = append(v.Varieties, c.pokemonRef(variety.Pokemon))
+	}
+
+	return v
+}
+
+// EvolutionStepV1 is one species in a flattened evolution chain, listed after
+// the species it evolves from.
+type EvolutionStepV1 struct {
+	Name        string
+	URL         string
+	Stage       int
+	EvolvesFrom string
+	IsBaby      bool
+	Conditions  []EvolutionConditionV1
+}
+
+// EvolutionConditionV1 is one way of evolving into a species. Only the
+// conditions that apply are set.
+type EvolutionConditionV1 struct {
+	Trigger      string
+	MinLevel     *int   `json:",omitempty"`
+	MinHappiness *int   `json:",omitempty"`
+	MinAffection *int   `json:",omitempty"`
+	Item         string `json:",omitempty"`
+	HeldItem     string `json:",omitempty"`
+	KnownMove    string `json:",omitempty"`
+	TimeOfDay    string `json:",omitempty"`
+}
+
+// NewEvolutionsV1 flattens an evolution chain depth first, starting with its
+// base species at stage 0.
+func (c *Client) NewEvolutionsV1(chain EvolutionChain) []EvolutionStepV1 {
+	steps := []EvolutionStepV1{}
+
+	var walk func(link ChainLink, stage int, from string)
+	walk = func(link ChainLink, stage int, from string) {
+		ref := c.pokemonRef(link.Species)
+
+		step := EvolutionStepV1{
+			Name:        ref.Name,
+			URL:         ref.URL,
+			Stage:       stage,
+			EvolvesFrom: from,
+			IsBaby:      link.IsBaby,
+			Conditions:  make([]EvolutionConditionV1, 0, len(link.EvolutionDetails)),
+		}
+
+		for _, detail := range link.EvolutionDetails {
+			condition := EvolutionConditionV1{
+				Trigger:      detail.Trigger.Name,
+				MinLevel:     detail.MinLevel,
+				MinHappiness: detail.MinHappiness,
+				MinAffection: detail.MinAffection,
+				TimeOfDay:    detail.TimeOfDay,
+			}
+
+			if detail.Item != nil {
+				condition.Item = detail.Item.Name
+			}
+			if detail.HeldItem != nil {
+				condition.HeldItem = detail.HeldItem.Name
+			}
+			if detail.KnownMove != nil {
+				condition.KnownMove = detail.KnownMove.Name
+			}
+
+			step.Conditions = append(step.Conditions, condition)
+		}
+
+		steps = append(steps, step)
+
+		for _, next := range link.EvolvesTo {
+			walk(next, stage+1, link.Species.Name)
+		}
+	}
+
+	walk(chain.Chain, 0, "")
+
+	return steps
+}
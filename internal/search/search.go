@@ -0,0 +1,201 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// Field is the kind of text a document was matched on.
+type Field string
+
+const (
+	FieldName    Field = "name"
+	FieldAbility Field = "ability"
+	FieldMove    Field = "move"
+)
+
+// A match on a document's own name outranks a match on one of its abilities,
+// which outranks a match on one of its moves.
+var fieldWeights = map[Field]float64{
+	FieldName:    1,
+	FieldAbility: 0.7,
+	FieldMove:    0.5,
+}
+
+// minSimilarity is the trigram similarity below which a term is not
+// considered a misspelling of the query.
+const minSimilarity = 0.45
+
+type Result struct {
+	ID      int
+	Name    string
+	Score   float64
+	Field   Field
+	Matched string
+}
+
+type document struct {
+	id   int
+	name string
+}
+
+type term struct {
+	field    Field
+	value    string
+	key      string
+	trigrams map[string]struct{}
+	docs     []int
+}
+
+// Index is an in-memory, read-only once built, index over named documents
+// (Pokémon) and the terms attached to them. It matches exact names, prefixes
+// of names or of words within them, and misspellings by trigram similarity.
+type Index struct {
+	docs      []document
+	docByID   map[int]int
+	terms     []*term
+	termByKey map[Field]map[string]*term
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docByID:   make(map[int]int),
+		termByKey: make(map[Field]map[string]*term),
+	}
+}
+
+// Add attaches value to the document with the given ID and name. Documents
+// are matched on their own name only if it is added with FieldName.
+func (idx *Index) Add(id int, name string, field Field, value string) {
+	doc, ok := idx.docByID[id]
+	if !ok {
+		doc = len(idx.docs)
+		idx.docs = append(idx.docs, document{id: id, name: name})
+		idx.docByID[id] = doc
+	}
+
+	key := normalize(value)
+	if key == "" {
+		return
+	}
+
+	if idx.termByKey[field] == nil {
+		idx.termByKey[field] = make(map[string]*term)
+	}
+
+	t, ok := idx.termByKey[field][key]
+	if !ok {
+		t = &term{field: field, value: value, key: key, trigrams: trigrams(key)}
+		idx.termByKey[field][key] = t
+		idx.terms = append(idx.terms, t)
+	}
+
+	t.docs = append(t.docs, doc)
+}
+
+// Len returns the number of documents in the index.
+func (idx *Index) Len() int {
+	return len(idx.docs)
+}
+
+// Search returns up to limit documents matching query, best first.
+func (idx *Index) Search(query string, limit int) []Result {
+	key := normalize(query)
+	if key == "" || limit < 1 {
+		return []Result{}
+	}
+
+	queryTrigrams := trigrams(key)
+	best := make(map[int]Result)
+
+	for _, t := range idx.terms {
+		score := similarity(key, queryTrigrams, t)
+		if score == 0 {
+			continue
+		}
+
+		score *= fieldWeights[t.field]
+
+		for _, doc := range t.docs {
+			if current, ok := best[doc]; ok && current.Score >= score {
+				continue
+			}
+
+			best[doc] = Result{
+				ID:      idx.docs[doc].id,
+				Name:    idx.docs[doc].name,
+				Score:   score,
+				Field:   t.field,
+				Matched: t.value,
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// similarity scores how well t matches the normalized query, from 1 for an
+// exact match down to minSimilarity, or 0 for no match at all.
+func similarity(query string, queryTrigrams map[string]struct{}, t *term) float64 {
+	switch {
+	case t.key == query:
+		return 1
+	case strings.HasPrefix(t.key, query):
+		// Prefer the shortest completion, "char" ranks charmander before
+		// charizard-mega-x
+		return 0.9 + 0.05*float64(len(query))/float64(len(t.key))
+	case strings.Contains(t.key, " "+query):
+		return 0.8 + 0.05*float64(len(query))/float64(len(t.key))
+	}
+
+	common := 0
+	for gram := range queryTrigrams {
+		if _, ok := t.trigrams[gram]; ok {
+			common++
+		}
+	}
+
+	dice := 2 * float64(common) / float64(len(queryTrigrams)+len(t.trigrams))
+	if dice < minSimilarity {
+		return 0
+	}
+
+	return 0.75 * dice
+}
+
+// normalize lower-cases s and treats hyphens and underscores, as used in
+// PokeAPI names, the same as spaces.
+func normalize(s string) string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer("-", " ", "_", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// trigrams returns the set of three character sequences in s, padded so that
+// the start and end of the word carry extra weight.
+func trigrams(s string) map[string]struct{} {
+	runes := []rune("  " + s + " ")
+	grams := make(map[string]struct{}, len(runes))
+
+	for i := 0; i+3 <= len(runes); i++ {
+		grams[string(runes[i:i+3])] = struct{}{}
+	}
+
+	return grams
+}
@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	BaseURL   string
+	UserAgent string
+	Timeout   time.Duration
+
+	// Idempotent requests that fail with a transport error, 429 or 5xx are
+	// retried up to MaxRetries times, sleeping a random duration of up to
+	// RetryBaseDelay * 2^attempt (capped at RetryMaxDelay) in between.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// The circuit breaker opens after BreakerThreshold consecutive failed
+	// calls and stays open for BreakerCooldown. Zero disables it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Client sends requests to the upstream PokeAPI (or anything that mirrors it)
+// with a fixed base URL, User-Agent and timeouts, retrying transient failures
+// and backing off entirely while the upstream is unhealthy.
+type Client struct {
+	baseURL        string
+	userAgent      string
+	httpClient     *http.Client
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	breaker        *breaker
+}
+
+func New(opts Options) *Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &Client{
+		baseURL:   strings.TrimSuffix(opts.BaseURL, "/"),
+		userAgent: opts.UserAgent,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+		maxRetries:     opts.MaxRetries,
+		retryBaseDelay: opts.RetryBaseDelay,
+		retryMaxDelay:  opts.RetryMaxDelay,
+		breaker:        newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+	}
+}
+
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+func (c *Client) BreakerStatus() BreakerStatus {
+	return c.breaker.status()
+}
+
+func (c *Client) Do(request *http.Request) (*http.Response, error) {
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
+	}
+
+	if !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	maxRetries := c.maxRetries
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := c.httpClient.Do(request)
+
+		if !isRetryable(response, err) {
+			c.breaker.record(true)
+			return response, err
+		}
+
+		if attempt >= maxRetries {
+			c.breaker.record(false)
+			return response, err
+		}
+
+		if response != nil {
+			response.Body.Close()
+		}
+
+		select {
+		case <-request.Context().Done():
+			c.breaker.record(false)
+			return nil, request.Context().Err()
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+func isRetryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// backoff returns a fully jittered exponential delay for the given attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.retryBaseDelay << attempt
+	if delay <= 0 || (c.retryMaxDelay > 0 && delay > c.retryMaxDelay) {
+		delay = c.retryMaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)))
+}